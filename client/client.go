@@ -1,6 +1,7 @@
 package client
 
 import (
+	"bytes"
 	"crypto/rsa"
 	"crypto_utils"
 	"encoding/json"
@@ -202,40 +203,57 @@ func doLogin(request *Request, response *Response) {
 	}
 }
 
+// the operations done in a session
+func isSessionOp(op Operation) bool {
+	switch op {
+	case CREATE, DELETE, READ, WRITE, COPY, CHANGE_PASS, MODACL, REVACL,
+		GROUP_CREATE, GROUP_ADD, GROUP_REMOVE, GROUP_LIST, CHOWN, CHOWN_ACCEPT, ACCESS,
+		MFA_ENROLL, MFA_VERIFY, USER_LIST, USER_LOCK, USER_UNLOCK, RESET_PASS, SET_ROLE,
+		AUDIT_QUERY, BATCH, LIST, INCR, APPEND, RENAME:
+		return true
+	}
+	return false
+}
+
 func ProcessOp(request *Request) *Response {
 	response := &Response{Status: FAIL}
-	if validateRequest(request) {
-		switch request.Op {
-		case CREATE, DELETE, READ, WRITE, COPY, CHANGE_PASS, MODACL, REVACL:
-			request.Uid = sessionUID //no effect if sessionUID not set
-			// if sessionUID is set
-			// if sessionUID != "" {
+	if (isSessionOp(request.Op) || request.Op == LOGOUT) && sessionUID == "" {
+		response.Error = ERR_NO_SESSION
+		response.Message = "not logged in"
+		return response
+	}
+	if !validateRequest(request) {
+		response.Error = ERR_BAD_REQUEST
+		response.Message = "missing or invalid parameters"
+		return response
+	}
+	switch {
+	case isSessionOp(request.Op):
+		request.Uid = sessionUID
+		doOp(request, response)
+	case request.Op == REGISTER:
+		if sessionUID == "" {
+			doRegister(request, response)
+		} else {
 			doOp(request, response)
-			// }
-		case REGISTER:
-			if sessionUID == "" {
-				doRegister(request, response)
-			} else {
-				doOp(request, response)
-			}
-		case LOGIN:
+		}
+	case request.Op == LOGIN:
 
-			if sessionUID == "" {
-				doLogin(request, response)
+		if sessionUID == "" {
+			doLogin(request, response)
 
-			} else {
-				doOp(request, response)
-			}
-		case LOGOUT:
+		} else {
 			doOp(request, response)
-			// if response.Status == OK { //reset only if successfully logged out
-			sessionUID = ""
-			// }
-
-		default:
-			// struct already default initialized to
-			// FAIL status
 		}
+	case request.Op == LOGOUT:
+		doOp(request, response)
+		// if response.Status == OK { //reset only if successfully logged out
+		sessionUID = ""
+		// }
+
+	default:
+		// struct already default initialized to
+		// FAIL status
 	}
 	return response
 }
@@ -244,8 +262,10 @@ func validateRequest(r *Request) bool {
 	switch r.Op {
 	case CREATE, WRITE:
 		return r.Key != "" && r.Val != nil
-	case DELETE, READ:
+	case DELETE, READ, INCR:
 		return r.Key != ""
+	case APPEND:
+		return r.Key != "" && r.Val != nil
 	case COPY:
 		return r.Src_key != "" && r.Dst_key != ""
 	case REGISTER:
@@ -261,6 +281,44 @@ func validateRequest(r *Request) bool {
 		return sessionUID != ""
 	case REVACL:
 		return sessionUID != ""
+	case GROUP_CREATE:
+		return sessionUID != "" && r.Group != ""
+	case GROUP_ADD, GROUP_REMOVE:
+		return sessionUID != "" && r.Group != "" && len(r.Members) > 0
+	case GROUP_LIST:
+		return sessionUID != ""
+	case CHOWN:
+		return sessionUID != "" && r.Key != "" && r.New_owner != ""
+	case RENAME:
+		return sessionUID != "" && r.Key != "" && r.New_key != ""
+	case CHOWN_ACCEPT:
+		return sessionUID != "" && r.Key != ""
+	case ACCESS, MFA_ENROLL:
+		return sessionUID != ""
+	case MFA_VERIFY:
+		return sessionUID != "" && r.Otp != ""
+	case USER_LIST:
+		return sessionUID != ""
+	case USER_LOCK, USER_UNLOCK:
+		return sessionUID != "" && r.Subject != ""
+	case RESET_PASS:
+		return sessionUID != "" && r.Subject != "" && r.New_pass != ""
+	case SET_ROLE:
+		return sessionUID != "" && r.Subject != "" && r.Role != ""
+	case AUDIT_QUERY:
+		return sessionUID != "" && (r.Subject != "" || r.Key != "")
+	case LIST:
+		return sessionUID != "" && r.Limit >= 0
+	case BATCH:
+		if len(r.Batch) == 0 {
+			return false
+		}
+		for i := range r.Batch {
+			if !isSessionOp(r.Batch[i].Op) || r.Batch[i].Op == BATCH || !validateRequest(&r.Batch[i]) {
+				return false
+			}
+		}
+		return sessionUID != ""
 	default:
 		return false
 	}
@@ -273,14 +331,21 @@ func doOp(request *Request, response *Response) {
 		requestBytes = crypto_utils.EncryptSK(requestBytes, sessionKey)
 		encrypt_response := sendAndReceive(NetworkData{Payload: requestBytes, Name: name}).Payload
 		decrypt_response, _ := crypto_utils.DecryptSK(encrypt_response, sessionKey)
-		json.Unmarshal(decrypt_response, &response)
+		decodeResponse(decrypt_response, response)
 
 	} else {
-		json.Unmarshal(sendAndReceive(NetworkData{Payload: requestBytes, Name: name}).Payload, &response)
+		decodeResponse(sendAndReceive(NetworkData{Payload: requestBytes, Name: name}).Payload, response)
 
 	}
 }
 
+// decode a response, keeping the numbers of the values exact
+func decodeResponse(data []byte, response *Response) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	dec.Decode(response)
+}
+
 func sendAndReceive(toSend NetworkData) NetworkData {
 	Requests <- toSend
 	return <-Responses
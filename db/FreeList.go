@@ -26,6 +26,9 @@ type FreeList struct {
 
 // number of items in the list
 func (fl *FreeList) Total() int {
+	if fl.head == 0 {
+		return 0 // empty list
+	}
 	node := fl.get(fl.head)
 	return int(binary.LittleEndian.Uint64(node[4:12]))
 }
@@ -79,9 +82,7 @@ func flPush(fl *FreeList, freed []uint64, reuse []uint64) {
 			flnSetPtr(new, i, ptr)
 		}
 		freed = freed[size:]
-		// update the total count
-		total := uint64(fl.Total() + size)
-		flnSetTotal(new, total)
+		// the total count is set by the caller
 		if len(reuse) > 0 {
 			// reuse a pointer from the list
 			fl.head, reuse = reuse[0], reuse[1:]
@@ -136,7 +137,9 @@ func (fl *FreeList) Update(popn int, freed []uint64) {
 	// phase 3: prepend new nodes
 	flPush(fl, freed, reuse)
 	// done
-	flnSetTotal(fl.get(fl.head), uint64(total+len(freed)))
+	if fl.head != 0 {
+		flnSetTotal(fl.get(fl.head), uint64(total+len(freed)))
+	}
 }
 
 func (fl *FreeList) DebugPrint() {
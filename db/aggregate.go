@@ -0,0 +1,147 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	AGG_COUNT = iota + 1
+	AGG_MIN
+	AGG_MAX
+	AGG_SUM // INT64 only
+)
+
+type Aggregate struct {
+	Func int    // AGG_?
+	Col  string // not used by AGG_COUNT
+}
+
+// the output column name, such as `count` or `sum(size)`
+func (agg Aggregate) Name() string {
+	name := map[int]string{AGG_COUNT: "count", AGG_MIN: "min", AGG_MAX: "max", AGG_SUM: "sum"}[agg.Func]
+	if agg.Func == AGG_COUNT {
+		return name
+	}
+	return fmt.Sprintf("%s(%s)", name, agg.Col)
+}
+
+// aggregate the rows in the range of the scanner
+type AggReq struct {
+	Scanner
+	GroupBy []string
+	Aggs    []Aggregate
+}
+
+// One row per group ordered by the GroupBy columns, each row is the
+// GroupBy columns followed by the aggregates. Without GroupBy there is
+// always a single row, MIN and MAX of no rows are zero values.
+func (db *DB) Aggregate(table string, req *AggReq) ([]Record, error) {
+	return db.reader().Aggregate(table, req)
+}
+func (tx *DBTX) Aggregate(table string, req *AggReq) ([]Record, error) {
+	tdef := getTableDef(tx, table)
+	if tdef == nil {
+		return nil, fmt.Errorf("table not found: %s", table)
+	}
+	return dbAggregate(tx, tdef, req)
+}
+
+type aggGroup struct {
+	keys Record
+	vals []Value
+	n    int64 // number of rows
+}
+
+func dbAggregate(tx *DBTX, tdef *TableDef, req *AggReq) ([]Record, error) {
+	// only the needed columns are decoded
+	req.Cols = append([]string{}, req.GroupBy...)
+	for _, agg := range req.Aggs {
+		if agg.Func < AGG_COUNT || agg.Func > AGG_SUM {
+			return nil, fmt.Errorf("bad aggregate: %d", agg.Func)
+		}
+		if agg.Func == AGG_COUNT {
+			continue
+		}
+		idx := colIndex(tdef, agg.Col)
+		if idx < 0 {
+			return nil, fmt.Errorf("unknown column: %s", agg.Col)
+		}
+		if agg.Func == AGG_SUM && tdef.Types[idx] != TYPE_INT64 {
+			return nil, fmt.Errorf("sum of a non-integer column: %s", agg.Col)
+		}
+		req.Cols = append(req.Cols, agg.Col)
+	}
+	if len(req.Cols) == 0 {
+		req.Cols = tdef.Cols[:1] // count only
+	}
+	if err := dbScan(tx, tdef, &req.Scanner); err != nil {
+		return nil, err
+	}
+	groups := map[string]*aggGroup{}
+	for ; req.Valid(); req.Next() {
+		rec := Record{}
+		req.Deref(&rec)
+		keys := Record{Cols: req.GroupBy, Vals: rec.Vals[:len(req.GroupBy)]}
+		id := string(encodeValues(nil, keys.Vals))
+		g := groups[id]
+		if g == nil {
+			g = &aggGroup{keys: keys, vals: make([]Value, len(req.Aggs))}
+			groups[id] = g
+		}
+		g.n++
+		for i, agg := range req.Aggs {
+			aggStep(&g.vals[i], agg, rec.Get(agg.Col), g.n == 1)
+		}
+	}
+	if err := req.Err(); err != nil {
+		return nil, err
+	}
+	if len(req.GroupBy) == 0 && len(groups) == 0 {
+		g := &aggGroup{vals: make([]Value, len(req.Aggs))}
+		for i, agg := range req.Aggs {
+			g.vals[i].Type = TYPE_INT64
+			if agg.Func != AGG_COUNT {
+				g.vals[i].Type = tdef.Types[colIndex(tdef, agg.Col)]
+			}
+		}
+		groups[""] = g
+	}
+	// output in the order of the group keys
+	ids := []string{}
+	for id := range groups {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	out := []Record{}
+	for _, id := range ids {
+		g := groups[id]
+		rec := Record{Cols: append([]string{}, g.keys.Cols...), Vals: append([]Value{}, g.keys.Vals...)}
+		for i, agg := range req.Aggs {
+			rec.Cols = append(rec.Cols, agg.Name())
+			rec.Vals = append(rec.Vals, g.vals[i])
+		}
+		out = append(out, rec)
+	}
+	return out, nil
+}
+
+// fold a row into the aggregate
+func aggStep(acc *Value, agg Aggregate, val *Value, first bool) {
+	switch agg.Func {
+	case AGG_COUNT:
+		acc.Type = TYPE_INT64
+		acc.I64++
+	case AGG_SUM:
+		acc.Type = TYPE_INT64
+		acc.I64 += val.I64
+	case AGG_MIN:
+		if first || qlCompare(*val, *acc) < 0 {
+			*acc = *val
+		}
+	case AGG_MAX:
+		if first || qlCompare(*val, *acc) > 0 {
+			*acc = *val
+		}
+	}
+}
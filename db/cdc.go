@@ -0,0 +1,233 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"sync"
+	. "types"
+	. "utils"
+)
+
+// a row mutation, Old is nil for an insert and New is nil for a delete
+type Change struct {
+	Seq   uint64 // the position in the change log, ordered by commits
+	Table string
+	Key   Record // the primary key
+	Old   *Record
+	New   *Record
+}
+
+type changeFeed struct {
+	mu   sync.Mutex // held from the commit until the changes are delivered
+	subs map[int]func(Change)
+	next int
+}
+
+// the meta key of the position of a consumer
+const CONSUMER_PREFIX = "consumer:"
+
+// Log the changes of a user table from now on. Nothing is logged
+// unless asked, the log keeps the old and the new rows in clear.
+func (db *DB) Capture(table string) {
+	if db.capture == nil {
+		db.capture = map[string]bool{}
+	}
+	db.capture[table] = true
+}
+
+// Stop logging the changes of a table.
+func (db *DB) StopCapture(table string) {
+	delete(db.capture, table)
+}
+
+// the changes of the table are logged
+func (db *DB) Captured(table string) bool {
+	return db.capture[table]
+}
+
+// record a mutation of a user table in the transaction
+func (tx *DBTX) capture(tdef *TableDef, old *Record, new *Record) {
+	if tdef.Prefix < TABLE_PREFIX_MIN || !tx.db.capture[tdef.Name] {
+		return // internal or not captured tables
+	}
+	row := old
+	if row == nil {
+		row = new
+	}
+	tx.changes = append(tx.changes, Change{
+		Table: tdef.Name,
+		Key:   Record{Cols: tdef.Cols[:tdef.PKeys], Vals: row.Vals[:tdef.PKeys]},
+		Old:   old,
+		New:   new,
+	})
+}
+
+// assign the sequence numbers and append the changes to the log,
+// within the transaction that made them.
+func logChanges(tx *DBTX) error {
+	if len(tx.changes) == 0 {
+		return nil
+	}
+	meta := (&Record{}).AddStr("key", []byte("next_seq"))
+	ok, err := dbGet(tx, TDEF_META, meta)
+	Assert(err == nil)
+	seq := uint64(1)
+	if ok {
+		seq = binary.BigEndian.Uint64(meta.Get("val").Str)
+	} else {
+		meta.AddStr("val", make([]byte, 8))
+	}
+	for i := range tx.changes {
+		ch := &tx.changes[i]
+		ch.Seq = seq
+		seq++
+		rec := (&Record{}).AddInt64("seq", int64(ch.Seq)).AddStr("table", []byte(ch.Table))
+		rec.AddStr("key", jsonBytes(ch.Key))
+		rec.AddStr("old", jsonBytes(ch.Old))
+		rec.AddStr("new", jsonBytes(ch.New))
+		if _, err := dbUpdate(tx, TDEF_CHANGES, *rec, MODE_INSERT_ONLY); err != nil {
+			return err
+		}
+	}
+	binary.BigEndian.PutUint64(meta.Get("val").Str, seq)
+	_, err = dbUpdate(tx, TDEF_META, *meta, MODE_UPSERT)
+	return err
+}
+
+func jsonBytes(v interface{}) []byte {
+	data, err := json.Marshal(v)
+	Assert(err == nil)
+	return data
+}
+
+// deliver the committed changes to the subscribers
+func (feed *changeFeed) publish(changes []Change) {
+	for _, ch := range changes {
+		for _, fn := range feed.subs {
+			fn(ch)
+		}
+	}
+}
+
+// Read the change log from a sequence number, up to limit changes (0 for no limit).
+// A consumer resumes from the sequence number after the last one it has seen.
+func (db *DB) Changes(from uint64, limit int) ([]Change, error) {
+	tx := db.reader()
+	sc := Scanner{
+		Cmp1: CMP_GE, Key1: *(&Record{}).AddInt64("seq", int64(from)),
+		Cmp2: CMP_LE,
+	}
+	if err := dbScan(tx, TDEF_CHANGES, &sc); err != nil {
+		return nil, err
+	}
+	out := []Change{}
+	for ; sc.Valid() && (limit <= 0 || len(out) < limit); sc.Next() {
+		rec := Record{}
+		sc.Deref(&rec)
+		ch := Change{Seq: uint64(rec.Get("seq").I64), Table: string(rec.Get("table").Str)}
+		Assert(json.Unmarshal(rec.Get("key").Str, &ch.Key) == nil)
+		Assert(json.Unmarshal(rec.Get("old").Str, &ch.Old) == nil)
+		Assert(json.Unmarshal(rec.Get("new").Str, &ch.New) == nil)
+		out = append(out, ch)
+	}
+	return out, nil
+}
+
+// Receive the changes from a sequence number onwards: the logged changes
+// are replayed first, then the new ones are delivered after each commit.
+// The callback runs in the committing goroutine and must not write to
+// the database or cancel. Returns a function to cancel the subscription.
+func (db *DB) Subscribe(from uint64, fn func(Change)) (func(), error) {
+	feed := &db.feed
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+	// no commit can happen in between
+	logged, err := db.Changes(from, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, ch := range logged {
+		fn(ch)
+	}
+	if feed.subs == nil {
+		feed.subs = map[int]func(Change){}
+	}
+	id := feed.next
+	feed.next++
+	feed.subs[id] = fn
+	return func() {
+		feed.mu.Lock()
+		defer feed.mu.Unlock()
+		delete(feed.subs, id)
+	}, nil
+}
+
+// Record that a consumer has read the changes before a sequence number.
+// The log is kept for the consumers until TrimConsumed.
+func (db *DB) Ack(consumer string, before uint64) error {
+	rec := (&Record{}).AddStr("key", []byte(CONSUMER_PREFIX+consumer)).AddStr("val", make([]byte, 8))
+	binary.BigEndian.PutUint64(rec.Get("val").Str, before)
+	return db.update(func(tx *DBTX) error {
+		_, err := dbUpdate(tx, TDEF_META, *rec, MODE_UPSERT)
+		return err
+	})
+}
+
+// the lowest acknowledged position, nothing without consumers
+func (db *DB) consumed() (uint64, error) {
+	sc := Scanner{Cmp1: CMP_GE, Key1: *(&Record{}).AddStr("key", []byte(CONSUMER_PREFIX)), Cmp2: CMP_LE}
+	if err := dbScan(db.reader(), TDEF_META, &sc); err != nil {
+		return 0, err
+	}
+	low := uint64(math.MaxInt64)
+	for ; sc.Valid(); sc.Next() {
+		rec := Record{}
+		sc.Deref(&rec)
+		if !bytes.HasPrefix(rec.Get("key").Str, []byte(CONSUMER_PREFIX)) {
+			break
+		}
+		low = min(low, binary.BigEndian.Uint64(rec.Get("val").Str))
+	}
+	if low == math.MaxInt64 {
+		return 0, nil // kept for the consumers to come
+	}
+	return low, nil
+}
+
+// discard the logged changes every consumer has read, none
+// before a consumer has acknowledged a position
+func (db *DB) TrimConsumed() error {
+	before, err := db.consumed()
+	if err != nil {
+		return err
+	}
+	return db.TrimChanges(before)
+}
+
+// discard the logged changes before a sequence number
+func (db *DB) TrimChanges(before uint64) error {
+	return db.update(func(tx *DBTX) error {
+		sc := Scanner{
+			Cmp1: CMP_GE,
+			Cmp2: CMP_LT, Key2: *(&Record{}).AddInt64("seq", int64(before)),
+			Cols: TDEF_CHANGES.Cols[:1],
+		}
+		if err := dbScan(tx, TDEF_CHANGES, &sc); err != nil {
+			return err
+		}
+		keys := []Record{}
+		for ; sc.Valid(); sc.Next() {
+			rec := Record{}
+			sc.Deref(&rec)
+			keys = append(keys, rec)
+		}
+		for _, key := range keys {
+			if _, err := dbDelete(tx, TDEF_CHANGES, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,148 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	. "types"
+	. "utils"
+)
+
+var (
+	ErrKeyExist    = errors.New("key exist")
+	ErrKeyNotExist = errors.New("key not exist")
+	ErrUnique      = errors.New("unique constraint violated")
+	ErrForeignKey  = errors.New("foreign key constraint violated")
+)
+
+// the values of some columns of a full row
+func rowValues(row Record, cols []string) Record {
+	out := Record{}
+	for _, c := range cols {
+		out.Cols = append(out.Cols, c)
+		out.Vals = append(out.Vals, *row.Get(c))
+	}
+	return out
+}
+
+// the rows whose columns equal to the key, looked up by an index
+func scanEqual(tx *DBTX, tdef *TableDef, key Record) ([]Record, error) {
+	sc := Scanner{Cmp1: CMP_GE, Cmp2: CMP_LE, Key1: key, Key2: key}
+	if err := dbScan(tx, tdef, &sc); err != nil {
+		return nil, err
+	}
+	rows := []Record{}
+	for ; sc.Valid(); sc.Next() {
+		rec := Record{}
+		sc.Deref(&rec)
+		rows = append(rows, rec)
+	}
+	return rows, nil
+}
+
+// no other row has the same values on the unique columns
+func checkUniques(tx *DBTX, tdef *TableDef, row Record) error {
+	pk := encodeKey(nil, tdef.Prefix, row.Vals[:tdef.PKeys])
+	for _, cols := range tdef.Uniques {
+		rows, err := scanEqual(tx, tdef, rowValues(row, cols))
+		if err != nil {
+			return err
+		}
+		for _, other := range rows {
+			if !bytes.Equal(pk, encodeKey(nil, tdef.Prefix, other.Vals[:tdef.PKeys])) {
+				return fmt.Errorf("%w: %s %v", ErrUnique, tdef.Name, cols)
+			}
+		}
+	}
+	return nil
+}
+
+// the referenced rows must exist
+func checkRefs(tx *DBTX, tdef *TableDef, row Record) error {
+	for _, ref := range tdef.Refs {
+		parent := getTableDef(tx, ref.Table)
+		if parent == nil {
+			return fmt.Errorf("table not found: %s", ref.Table)
+		}
+		pk := rowValues(row, ref.Cols)
+		pk.Cols = parent.Cols[:parent.PKeys]
+		ok, err := dbGet(tx, parent, &pk)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%w: %s %v -> %s", ErrForeignKey, tdef.Name, ref.Cols, ref.Table)
+		}
+	}
+	return nil
+}
+
+// the referenced table must exist and the column types must match its primary key
+func checkTableRefs(tx *DBTX, tdef *TableDef) error {
+	for _, ref := range tdef.Refs {
+		parent := tdef
+		if ref.Table != tdef.Name {
+			parent = getTableDef(tx, ref.Table)
+		}
+		if parent == nil {
+			return fmt.Errorf("table not found: %s", ref.Table)
+		}
+		if len(ref.Cols) != parent.PKeys {
+			return fmt.Errorf("bad reference: %v -> %s", ref.Cols, ref.Table)
+		}
+		for i, c := range ref.Cols {
+			if tdef.Types[colIndex(tdef, c)] != parent.Types[i] {
+				return fmt.Errorf("bad reference type: %s -> %s", c, ref.Table)
+			}
+		}
+	}
+	return nil
+}
+
+// all the table definitions
+func listTables(tx *DBTX) []*TableDef {
+	sc := Scanner{Cmp1: CMP_GE, Cmp2: CMP_LE}
+	err := dbScan(tx, TDEF_TABLE, &sc)
+	Assert(err == nil)
+	tables := []*TableDef{}
+	for ; sc.Valid(); sc.Next() {
+		rec := Record{}
+		sc.Deref(&rec)
+		tdef := &TableDef{}
+		err = json.Unmarshal(rec.Get("def").Str, tdef)
+		Assert(err == nil)
+		tables = append(tables, tdef)
+	}
+	return tables
+}
+
+// a parent row is deleted, delete or reject the rows referencing it
+func deleteRefs(tx *DBTX, tdef *TableDef, row Record) error {
+	if tdef.Prefix < TABLE_PREFIX_MIN {
+		return nil // internal tables
+	}
+	for _, child := range listTables(tx) {
+		for _, ref := range child.Refs {
+			if ref.Table != tdef.Name {
+				continue
+			}
+			key := Record{Cols: ref.Cols, Vals: row.Vals[:tdef.PKeys]}
+			// collect the rows before modifying the tree
+			rows, err := scanEqual(tx, child, key)
+			if err != nil {
+				return err
+			}
+			if len(rows) > 0 && !ref.Cascade {
+				return fmt.Errorf("%w: %s is referenced by %s", ErrForeignKey, tdef.Name, child.Name)
+			}
+			for _, rec := range rows {
+				pk := Record{Cols: rec.Cols[:child.PKeys], Vals: rec.Vals[:child.PKeys]}
+				if _, err := dbDelete(tx, child, pk); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -6,11 +6,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	. "types"
 	. "utils"
 )
 
-const TABLE_PREFIX_MIN = 1
+const TABLE_PREFIX_MIN = 100 // prefixes below are reserved for the internal tables
 const (
 	TYPE_ERROR uint32 = iota
 	TYPE_BYTES
@@ -50,8 +49,10 @@ func (rec *Record) Get(key string) *Value {
 type DB struct {
 	Path string
 	// internals
-	kv     *KV
-	tables map[string]*TableDef // cached table definition
+	kv      *KV
+	tables  map[string]*TableDef // cached table definition
+	feed    changeFeed
+	capture map[string]bool // the tables whose changes are logged
 }
 
 // table definition
@@ -62,11 +63,20 @@ type TableDef struct {
 	Cols    []string // column names
 	PKeys   int      // the first PKeys columns are the primary key
 	Indexes [][]string
+	Uniques [][]string // the columns that are unique across rows
+	Refs    []TableRef // foreign keys
 	// auto-assigned B-tree key prefixes for different tables/indexes
 	Prefix        uint32
 	IndexPrefixes []uint32
 }
 
+// a foreign key: the columns reference the primary key of another table
+type TableRef struct {
+	Cols    []string
+	Table   string
+	Cascade bool // deleting the parent row deletes this row, otherwise it fails
+}
+
 // internal table: metadata
 var TDEF_META = &TableDef{
 	Prefix: 1,
@@ -85,54 +95,43 @@ var TDEF_TABLE = &TableDef{
 	PKeys:  1,
 }
 
-// get a single row by the primary key
-// func dbGet(db *DB, tdef *TableDef, rec *Record) (bool, error) {
-
-//		values, err := checkRecord(tdef, *rec, tdef.PKeys)
-//		if err != nil {
-//			return false, err
-//		}
-//		key := encodeKey(nil, tdef.Prefix, values[:tdef.PKeys])
-//		// fmt.Println("prefix", tdef.Prefix, "values:", values[:tdef.PKeys], "record", rec)
-//		// fmt.Printf("serach for key: %s\n", key)
-//		val, ok := db.kv.Get(key)
-//		if !ok {
-//			return false, nil
-//		}
-//		for i := tdef.PKeys; i < len(tdef.Cols); i++ {
-//			values[i].Type = tdef.Types[i]
-//		}
-//		decodeValues(val, values[tdef.PKeys:])
-//		rec.Cols = append(rec.Cols, tdef.Cols[tdef.PKeys:]...)
-//		rec.Vals = append(rec.Vals, values[tdef.PKeys:]...)
-//		return true, nil
-//	}
+// internal table: the change log, rows are JSON encoded
+var TDEF_CHANGES = &TableDef{
+	Prefix: 3,
+	Name:   "@changes",
+	Types:  []uint32{TYPE_INT64, TYPE_BYTES, TYPE_BYTES, TYPE_BYTES, TYPE_BYTES},
+	Cols:   []string{"seq", "table", "key", "old", "new"},
+	PKeys:  1,
+}
 
-func (db *DB) Open() {
+func (db *DB) Open() error {
 	db.kv = &KV{Path: db.Path}
-	db.kv.Open()
+	db.tables = nil
+	return db.kv.Open()
 }
 func (db *DB) Close() {
 	db.kv.Path = db.Path
 	db.kv.Close()
 }
 
-func dbGet(db *DB, tdef *TableDef, rec *Record) (bool, error) {
-	sc := Scanner{
-		Cmp1: CMP_GE,
-		Cmp2: CMP_LE,
-		Key1: *rec,
-		Key2: *rec,
-	}
-	if err := dbScan(db, tdef, &sc); err != nil {
+// get a single row by the primary key
+func dbGet(tx *DBTX, tdef *TableDef, rec *Record) (bool, error) {
+	values, err := checkRecord(tdef, *rec, tdef.PKeys)
+	if err != nil {
 		return false, err
 	}
-	if sc.Valid() {
-		sc.Deref(rec)
-		return true, nil
-	} else {
+	key := encodeKey(nil, tdef.Prefix, values[:tdef.PKeys])
+	val, ok := tx.kv.Get(key)
+	if !ok {
 		return false, nil
 	}
+	for i := tdef.PKeys; i < len(tdef.Cols); i++ {
+		values[i].Type = tdef.Types[i]
+	}
+	decodeValues(val, values[tdef.PKeys:])
+	rec.Cols = append([]string{}, tdef.Cols...)
+	rec.Vals = values
+	return true, nil
 }
 
 // reorder a record and check for missing columns.
@@ -287,6 +286,30 @@ func decodeValues(in []byte, out []Value) {
 	}
 }
 
+// like decodeValues, but only the wanted values are decoded,
+// the others are skipped over.
+func decodeWanted(in []byte, out []Value, want []bool) {
+	pos := 0
+	for i := range out {
+		switch out[i].Type {
+		case TYPE_INT64:
+			if want[i] {
+				decodeValues(in[pos:pos+8], out[i:i+1])
+			}
+			pos += 8
+		case TYPE_BYTES:
+			end := bytes.IndexByte(in[pos:], 0)
+			Assert(end >= 0)
+			if want[i] {
+				decodeValues(in[pos:pos+end+1], out[i:i+1])
+			}
+			pos += end + 1
+		default:
+			panic("bad type")
+		}
+	}
+}
+
 // for primary keys
 func encodeKey(out []byte, prefix uint32, vals []Value) []byte {
 	var buf [4]byte
@@ -296,31 +319,33 @@ func encodeKey(out []byte, prefix uint32, vals []Value) []byte {
 	return out
 }
 func (db *DB) Get(table string, rec *Record) (bool, error) {
-	tdef := getTableDef(db, table)
-	if tdef == nil {
-		return false, fmt.Errorf("table not found: %s", table)
-	}
-	return dbGet(db, tdef, rec)
+	return db.reader().Get(table, rec)
+}
+
+// the definition of a table, nil if the table does not exist
+func (db *DB) GetTableDef(name string) *TableDef {
+	return getTableDef(db.reader(), name)
 }
 
 // get the table definition by name
-func getTableDef(db *DB, name string) *TableDef {
+func getTableDef(tx *DBTX, name string) *TableDef {
+	db := tx.db
 	tdef, ok := db.tables[name]
 	if !ok {
 		if db.tables == nil {
 			db.tables = map[string]*TableDef{}
 		}
-		tdef = getTableDefDB(db, name)
+		tdef = getTableDefDB(tx, name)
 		if tdef != nil {
 			db.tables[name] = tdef
 		}
 	}
 	return tdef
 }
-func getTableDefDB(db *DB, name string) *TableDef {
+func getTableDefDB(tx *DBTX, name string) *TableDef {
 	rec := (&Record{}).AddStr("name", []byte(name))
 	// fmt.Println("get the table def from intenal")
-	ok, err := dbGet(db, TDEF_TABLE, rec)
+	ok, err := dbGet(tx, TDEF_TABLE, rec)
 	Assert(err == nil)
 	if !ok {
 		return nil
@@ -335,7 +360,12 @@ func checkIndexKeys(tdef *TableDef, index []string) ([]string, error) {
 	icols := map[string]bool{}
 	for _, c := range index {
 		// check the index columns
-		// omitted...
+		if colIndex(tdef, c) < 0 {
+			return nil, fmt.Errorf("unknown index column: %s", c)
+		}
+		if icols[c] {
+			return nil, fmt.Errorf("duplicated index column: %s", c)
+		}
 		icols[c] = true
 	}
 	// add the primary key to the index
@@ -344,7 +374,7 @@ func checkIndexKeys(tdef *TableDef, index []string) ([]string, error) {
 			index = append(index, c)
 		}
 	}
-	Assert(len(index) < len(tdef.Cols))
+	Assert(len(index) <= len(tdef.Cols))
 	return index, nil
 }
 func colIndex(tdef *TableDef, col string) int {
@@ -357,7 +387,20 @@ func colIndex(tdef *TableDef, col string) int {
 }
 func tableDefCheck(tdef *TableDef) error {
 	// verify the table definition
-	// omitted...
+	if tdef.Name == "" || len(tdef.Cols) == 0 || len(tdef.Cols) != len(tdef.Types) {
+		return fmt.Errorf("bad table definition: %s", tdef.Name)
+	}
+	if tdef.PKeys < 1 || tdef.PKeys > len(tdef.Cols) {
+		return fmt.Errorf("bad primary key: %s", tdef.Name)
+	}
+	for i, c := range tdef.Cols {
+		if colIndex(tdef, c) != i {
+			return fmt.Errorf("duplicated column: %s", c)
+		}
+		if tdef.Types[i] != TYPE_BYTES && tdef.Types[i] != TYPE_INT64 {
+			return fmt.Errorf("bad column type: %s", c)
+		}
+	}
 	// verify the indexes
 	for i, index := range tdef.Indexes {
 		index, err := checkIndexKeys(tdef, index)
@@ -366,5 +409,34 @@ func tableDefCheck(tdef *TableDef) error {
 		}
 		tdef.Indexes[i] = index
 	}
+	// unique and foreign key columns are looked up by an index
+	for _, cols := range tdef.Uniques {
+		if err := addIndexFor(tdef, cols); err != nil {
+			return err
+		}
+	}
+	for _, ref := range tdef.Refs {
+		if ref.Table == "" {
+			return fmt.Errorf("bad reference: %v", ref.Cols)
+		}
+		if err := addIndexFor(tdef, ref.Cols); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add an index on the columns unless an existing one can be used
+func addIndexFor(tdef *TableDef, cols []string) error {
+	if len(cols) == 0 {
+		return fmt.Errorf("empty constraint columns: %s", tdef.Name)
+	}
+	index, err := checkIndexKeys(tdef, append([]string{}, cols...))
+	if err != nil {
+		return err
+	}
+	if _, err := findIndex(tdef, cols); err != nil {
+		tdef.Indexes = append(tdef.Indexes, index)
+	}
 	return nil
 }
@@ -48,10 +48,9 @@ type KV struct {
 		chunks [][]byte // multiple mmaps, can be non-continuous
 	}
 	page struct {
-		flushed uint64   // database size in number of pages
-		temp    [][]byte // newly allocated pages
-		nfree   int      // number of pages taken from the free list
-		nappend int      // number of pages to be appended
+		flushed uint64 // database size in number of pages
+		nfree   int    // number of pages taken from the free list
+		nappend int    // number of pages to be appended
 		// newly allocated or deallocated pages keyed by the pointer.
 		// nil value denotes a deallocated page.
 		updates map[uint64][]byte
@@ -67,7 +66,7 @@ func extendMmap(db *KV, npages int) error {
 	}
 	// double the address space
 	chunk, err := syscall.Mmap(
-		int(db.fp.Fd()), 0, db.mmap.total,
+		int(db.fp.Fd()), int64(db.mmap.total), db.mmap.total,
 		syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED,
 	)
 	if err != nil {
@@ -89,9 +88,9 @@ func NewKv(path string) *KV {
 func (db *KV) Update(key []byte, val []byte, mode int) (bool, error) {
 	_, ok := db.Get(key)
 	if ok && mode == MODE_INSERT_ONLY {
-		return false, errors.New("key exist")
+		return false, ErrKeyExist
 	} else if !ok && mode == MODE_UPDATE_ONLY {
-		return false, errors.New("key not exist")
+		return false, ErrKeyNotExist
 	}
 	err := db.Set(key, val)
 	if err != nil {
@@ -145,7 +144,6 @@ func masterLoad(db *KV) error {
 func masterStore(db *KV) error {
 	var data [BTREE_PAGE_SIZE]byte
 	copy(data[:16], []byte(DB_SIG))
-	db.page.flushed = uint64(len(db.page.updates))
 	binary.LittleEndian.PutUint64(data[16:], db.tree.Root)
 	binary.LittleEndian.PutUint64(data[24:], db.page.flushed)
 	binary.LittleEndian.PutUint64(data[32:], db.free.head)
@@ -226,8 +224,6 @@ func (db *KV) Open() error {
 		return fmt.Errorf("OpenFile: %w", err)
 	}
 	db.page.updates = make(map[uint64][]byte)
-	node := make(BNode, BTREE_PAGE_SIZE)
-	db.page.updates[0] = node
 	db.fp = fp
 	// create the initial mmap
 	sz, chunk, err := mmapInit(db.fp)
@@ -256,21 +252,15 @@ func (db *KV) Open() error {
 	if err != nil {
 		goto fail
 	}
-
-	for i := uint64(1); i < db.page.flushed; i++ {
-		node := make(BNode, BTREE_PAGE_SIZE)
-		copy(node, pageGetMapped(db, i))
-		db.page.updates[i] = node
-	}
 	// done
-	// if db.free.head == 0 {
-
-	// 	node := make(BNode, BTREE_PAGE_SIZE)
-	// 	db.free.head = db.free.new(node)
-	// }
 	return nil
 fail:
-	db.Close()
+	// nothing is written back to a file that fails to load
+	for _, chunk := range db.mmap.chunks {
+		syscall.Munmap(chunk)
+	}
+	db.mmap.chunks = nil
+	fp.Close()
 	return fmt.Errorf("KV.Open: %w", err)
 }
 
@@ -349,7 +339,7 @@ func writePages(db *KV) error {
 
 	// copy pages to the file
 	for ptr, page := range db.page.updates {
-		if page != nil && ptr != 0 {
+		if page != nil {
 			copy(pageGetMapped(db, ptr), page)
 		}
 	}
@@ -360,8 +350,11 @@ func syncPages(db *KV) error {
 	if err := db.fp.Sync(); err != nil {
 		return fmt.Errorf("fsync: %w", err)
 	}
-	db.page.flushed += uint64(len(db.page.temp))
-	db.page.temp = db.page.temp[:0]
+	// the pending pages are in the file now
+	db.page.flushed += uint64(db.page.nappend)
+	db.page.nfree = 0
+	db.page.nappend = 0
+	db.page.updates = map[uint64][]byte{}
 	// update & flush the master page
 	if err := masterStore(db); err != nil {
 		return err
@@ -372,7 +365,6 @@ func syncPages(db *KV) error {
 	return nil
 }
 func loadMeta(db *KV, data []byte) error {
-	Assert(bytes.Compare(data[:16], []byte(DB_SIG)) == 0)
 	root := binary.LittleEndian.Uint64(data[16:])
 	used := binary.LittleEndian.Uint64(data[24:])
 	head := binary.LittleEndian.Uint64(data[32:])
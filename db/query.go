@@ -0,0 +1,547 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	. "types"
+)
+
+// A small SQL-ish query language over the tables:
+//
+//	SELECT a,b FROM t WHERE a >= 'x' AND b != 1 ORDER BY a DESC LIMIT 10 OFFSET 5
+//	INSERT INTO t (a,b) VALUES ('x', 1), ('y', 2)    (also REPLACE INTO, UPSERT INTO)
+//	UPDATE t SET b = b + 1 WHERE a = 'x'
+//	DELETE FROM t WHERE a < 'x'
+
+// syntax tree node types
+const (
+	QL_UNINIT = 0
+	// scalar, same as the column types
+	QL_STR = TYPE_BYTES
+	QL_I64 = TYPE_INT64
+	// binary ops
+	QL_CMP_GE = 10 // >=
+	QL_CMP_GT = 11 // >
+	QL_CMP_LT = 12 // <
+	QL_CMP_LE = 13 // <=
+	QL_CMP_EQ = 14 // =
+	QL_CMP_NE = 15 // !=
+	QL_ADD    = 20
+	QL_SUB    = 21
+	QL_AND    = 30
+	QL_OR     = 31
+	// unary ops
+	QL_NOT = 50
+	QL_NEG = 51
+	// others
+	QL_SYM = 100 // column
+)
+
+// syntax tree node
+type QLNode struct {
+	Value // Type, I64, Str
+	Kids  []QLNode
+}
+
+// common structure for statements: `FROM table WHERE cond LIMIT x OFFSET y`
+type QLScan struct {
+	Table  string
+	Filter QLNode // QL_UNINIT for no filter
+	Offset int64
+	Limit  int64 // -1 for no limit
+}
+
+// stmt: select
+type QLSelect struct {
+	QLScan
+	Names   []string // nil for `*`
+	OrderBy string   // empty for the scan order
+	Desc    bool
+}
+
+// stmt: update
+type QLUpdate struct {
+	QLScan
+	Names  []string
+	Values []QLNode
+}
+
+// stmt: insert
+type QLInsert struct {
+	Table  string
+	Mode   int      // MODE_INSERT_ONLY, MODE_UPDATE_ONLY or MODE_UPSERT
+	Names  []string // nil for all columns
+	Values [][]QLNode
+}
+
+// stmt: delete
+type QLDelete struct {
+	QLScan
+}
+
+const (
+	tokEOF = iota
+	tokSym // identifiers and keywords
+	tokStr
+	tokInt
+	tokOp // punctuation and operators
+)
+
+type qlToken struct {
+	kind int
+	text string
+}
+
+type qlParser struct {
+	toks []qlToken
+	pos  int
+}
+
+func qlLex(input string) ([]qlToken, error) {
+	toks := []qlToken{}
+	for i := 0; i < len(input); {
+		ch := input[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			i++
+		case isSymStart(ch):
+			j := i + 1
+			for j < len(input) && isSymChar(input[j]) {
+				j++
+			}
+			toks = append(toks, qlToken{tokSym, input[i:j]})
+			i = j
+		case ch >= '0' && ch <= '9':
+			j := i + 1
+			for j < len(input) && input[j] >= '0' && input[j] <= '9' {
+				j++
+			}
+			toks = append(toks, qlToken{tokInt, input[i:j]})
+			i = j
+		case ch == '\'':
+			// quotes are escaped by doubling them: 'it''s'
+			var sb strings.Builder
+			j := i + 1
+			for {
+				if j >= len(input) {
+					return nil, fmt.Errorf("unterminated string")
+				}
+				if input[j] == '\'' {
+					if j+1 < len(input) && input[j+1] == '\'' {
+						sb.WriteByte('\'')
+						j += 2
+						continue
+					}
+					break
+				}
+				sb.WriteByte(input[j])
+				j++
+			}
+			toks = append(toks, qlToken{tokStr, sb.String()})
+			i = j + 1
+		default:
+			op := ""
+			for _, candidate := range []string{">=", "<=", "!=", "<>", "(", ")", ",", "*", "=", "<", ">", "+", "-", ";"} {
+				if strings.HasPrefix(input[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character: %q", ch)
+			}
+			toks = append(toks, qlToken{tokOp, op})
+			i += len(op)
+		}
+	}
+	return append(toks, qlToken{tokEOF, ""}), nil
+}
+func isSymStart(ch byte) bool {
+	return ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+func isSymChar(ch byte) bool {
+	return isSymStart(ch) || (ch >= '0' && ch <= '9')
+}
+
+func (p *qlParser) peek() qlToken {
+	return p.toks[p.pos]
+}
+func (p *qlParser) next() qlToken {
+	tok := p.toks[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// consume a keyword (case-insensitive) if present
+func (p *qlParser) keyword(kws ...string) bool {
+	save := p.pos
+	for _, kw := range kws {
+		tok := p.next()
+		if tok.kind != tokSym || !strings.EqualFold(tok.text, kw) {
+			p.pos = save
+			return false
+		}
+	}
+	return true
+}
+
+// consume an operator if present
+func (p *qlParser) op(op string) bool {
+	if tok := p.peek(); tok.kind == tokOp && tok.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+func (p *qlParser) expectKeyword(kws ...string) error {
+	if !p.keyword(kws...) {
+		return fmt.Errorf("expect %s", strings.Join(kws, " "))
+	}
+	return nil
+}
+func (p *qlParser) expectOp(op string) error {
+	if !p.op(op) {
+		return fmt.Errorf("expect %q near %q", op, p.peek().text)
+	}
+	return nil
+}
+
+var qlKeywords = map[string]bool{
+	"select": true, "from": true, "where": true, "order": true, "by": true,
+	"asc": true, "desc": true, "limit": true, "offset": true, "insert": true,
+	"replace": true, "upsert": true, "into": true, "values": true,
+	"update": true, "set": true, "delete": true, "and": true, "or": true, "not": true,
+}
+
+func (p *qlParser) name() (string, error) {
+	tok := p.next()
+	if tok.kind != tokSym || qlKeywords[strings.ToLower(tok.text)] {
+		return "", fmt.Errorf("expect name near %q", tok.text)
+	}
+	return tok.text, nil
+}
+
+// a, b, c
+func (p *qlParser) nameList() ([]string, error) {
+	names := []string{}
+	for {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		if !p.op(",") {
+			return names, nil
+		}
+	}
+}
+
+func (p *qlParser) integer() (int64, error) {
+	tok := p.next()
+	if tok.kind != tokInt {
+		return 0, fmt.Errorf("expect integer near %q", tok.text)
+	}
+	return strconv.ParseInt(tok.text, 10, 64)
+}
+
+// parse a single statement
+func ParseQL(query string) (interface{}, error) {
+	toks, err := qlLex(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &qlParser{toks: toks}
+	var stmt interface{}
+	switch {
+	case p.keyword("select"):
+		stmt, err = p.parseSelect()
+	case p.keyword("insert", "into"):
+		stmt, err = p.parseInsert(MODE_INSERT_ONLY)
+	case p.keyword("replace", "into"):
+		stmt, err = p.parseInsert(MODE_UPDATE_ONLY)
+	case p.keyword("upsert", "into"):
+		stmt, err = p.parseInsert(MODE_UPSERT)
+	case p.keyword("update"):
+		stmt, err = p.parseUpdate()
+	case p.keyword("delete", "from"):
+		stmt, err = p.parseDelete()
+	default:
+		return nil, fmt.Errorf("unknown statement near %q", p.peek().text)
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.op(";")
+	if p.peek().kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q", p.peek().text)
+	}
+	return stmt, nil
+}
+
+// parse an expression, such as a filter for the Scanner
+func ParseExpr(expr string) (QLNode, error) {
+	toks, err := qlLex(expr)
+	if err != nil {
+		return QLNode{}, err
+	}
+	p := &qlParser{toks: toks}
+	node, err := p.parseExpr()
+	if err != nil {
+		return QLNode{}, err
+	}
+	if p.peek().kind != tokEOF {
+		return QLNode{}, fmt.Errorf("unexpected %q", p.peek().text)
+	}
+	return node, nil
+}
+
+func (p *qlParser) parseSelect() (*QLSelect, error) {
+	stmt := &QLSelect{}
+	if !p.op("*") {
+		names, err := p.nameList()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Names = names
+	}
+	if err := p.expectKeyword("from"); err != nil {
+		return nil, err
+	}
+	if err := p.parseScan(&stmt.QLScan); err != nil {
+		return nil, err
+	}
+	if err := p.parseOrderLimit(stmt); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// table [WHERE cond]
+func (p *qlParser) parseScan(scan *QLScan) error {
+	table, err := p.name()
+	if err != nil {
+		return err
+	}
+	scan.Table = table
+	scan.Limit = -1
+	if p.keyword("where") {
+		if scan.Filter, err = p.parseExpr(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// [ORDER BY col [ASC|DESC]] [LIMIT x [OFFSET y]]
+func (p *qlParser) parseOrderLimit(stmt *QLSelect) error {
+	var err error
+	if p.keyword("order", "by") {
+		if stmt.OrderBy, err = p.name(); err != nil {
+			return err
+		}
+		if p.keyword("desc") {
+			stmt.Desc = true
+		} else {
+			p.keyword("asc")
+		}
+	}
+	if p.keyword("limit") {
+		if stmt.Limit, err = p.integer(); err != nil {
+			return err
+		}
+		if p.keyword("offset") {
+			if stmt.Offset, err = p.integer(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// INTO table [(a, b)] VALUES (x, y), ...
+func (p *qlParser) parseInsert(mode int) (*QLInsert, error) {
+	stmt := &QLInsert{Mode: mode}
+	table, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Table = table
+	if p.op("(") {
+		if stmt.Names, err = p.nameList(); err != nil {
+			return nil, err
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectKeyword("values"); err != nil {
+		return nil, err
+	}
+	for {
+		if err := p.expectOp("("); err != nil {
+			return nil, err
+		}
+		row := []QLNode{}
+		for {
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			row = append(row, expr)
+			if !p.op(",") {
+				break
+			}
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+		stmt.Values = append(stmt.Values, row)
+		if !p.op(",") {
+			return stmt, nil
+		}
+	}
+}
+
+// table SET a = x, b = y [WHERE cond]
+func (p *qlParser) parseUpdate() (*QLUpdate, error) {
+	stmt := &QLUpdate{}
+	table, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("set"); err != nil {
+		return nil, err
+	}
+	for {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectOp("="); err != nil {
+			return nil, err
+		}
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Names = append(stmt.Names, name)
+		stmt.Values = append(stmt.Values, expr)
+		if !p.op(",") {
+			break
+		}
+	}
+	stmt.Table = table
+	stmt.Limit = -1
+	if p.keyword("where") {
+		if stmt.Filter, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+// FROM table [WHERE cond]
+func (p *qlParser) parseDelete() (*QLDelete, error) {
+	stmt := &QLDelete{}
+	if err := p.parseScan(&stmt.QLScan); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// expr := or
+// or   := and {OR and}
+// and  := not {AND not}
+// not  := NOT not | cmp
+// cmp  := add [op add]
+// add  := neg {(+|-) neg}
+// neg  := - neg | atom
+// atom := int | str | name | ( expr )
+func (p *qlParser) parseExpr() (QLNode, error) {
+	return p.parseBinary(0)
+}
+
+var qlBinaryLevels = [][]struct {
+	op   string
+	kw   bool
+	node uint32
+}{
+	{{"or", true, QL_OR}},
+	{{"and", true, QL_AND}},
+	nil, // NOT
+	{ // qlCmpLevel
+		{">=", false, QL_CMP_GE}, {">", false, QL_CMP_GT},
+		{"<=", false, QL_CMP_LE}, {"<", false, QL_CMP_LT},
+		{"=", false, QL_CMP_EQ}, {"!=", false, QL_CMP_NE}, {"<>", false, QL_CMP_NE},
+	},
+	{{"+", false, QL_ADD}, {"-", false, QL_SUB}},
+}
+
+const qlCmpLevel = 3
+
+func (p *qlParser) parseBinary(level int) (QLNode, error) {
+	switch {
+	case level == len(qlBinaryLevels):
+		return p.parseNeg()
+	case qlBinaryLevels[level] == nil:
+		if p.keyword("not") {
+			kid, err := p.parseBinary(level)
+			return QLNode{Value: Value{Type: QL_NOT}, Kids: []QLNode{kid}}, err
+		}
+		return p.parseBinary(level + 1)
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return left, err
+	}
+	for {
+		matched := false
+		for _, b := range qlBinaryLevels[level] {
+			if (b.kw && p.keyword(b.op)) || (!b.kw && p.op(b.op)) {
+				right, err := p.parseBinary(level + 1)
+				if err != nil {
+					return right, err
+				}
+				left = QLNode{Value: Value{Type: b.node}, Kids: []QLNode{left, right}}
+				matched = true
+				break
+			}
+		}
+		// comparisons do not chain
+		if !matched || level == qlCmpLevel {
+			return left, nil
+		}
+	}
+}
+func (p *qlParser) parseNeg() (QLNode, error) {
+	if p.op("-") {
+		kid, err := p.parseNeg()
+		return QLNode{Value: Value{Type: QL_NEG}, Kids: []QLNode{kid}}, err
+	}
+	return p.parseAtom()
+}
+func (p *qlParser) parseAtom() (QLNode, error) {
+	if p.op("(") {
+		expr, err := p.parseExpr()
+		if err != nil {
+			return expr, err
+		}
+		return expr, p.expectOp(")")
+	}
+	tok := p.peek()
+	switch tok.kind {
+	case tokInt:
+		i64, err := p.integer()
+		return QLNode{Value: Value{Type: QL_I64, I64: i64}}, err
+	case tokStr:
+		p.next()
+		return QLNode{Value: Value{Type: QL_STR, Str: []byte(tok.text)}}, nil
+	case tokSym:
+		name, err := p.name()
+		return QLNode{Value: Value{Type: QL_SYM, Str: []byte(name)}}, err
+	}
+	return QLNode{}, fmt.Errorf("expect expression near %q", tok.text)
+}
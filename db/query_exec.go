@@ -0,0 +1,447 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	. "types"
+)
+
+// the output of a statement
+type QLResult struct {
+	Cols     []string // for SELECT
+	Rows     []Record // for SELECT
+	Affected int      // for INSERT, UPDATE and DELETE
+}
+
+// parse and execute a single statement
+func (db *DB) Exec(query string) (*QLResult, error) {
+	stmt, err := ParseQL(query)
+	if err != nil {
+		return nil, err
+	}
+	if stmt, ok := stmt.(*QLSelect); ok {
+		return qlSelect(db.reader(), stmt)
+	}
+	// a write statement is all or nothing
+	var out *QLResult
+	err = db.update(func(tx *DBTX) (err error) {
+		switch stmt := stmt.(type) {
+		case *QLInsert:
+			out, err = qlInsert(tx, stmt)
+		case *QLUpdate:
+			out, err = qlUpdate(tx, stmt)
+		case *QLDelete:
+			out, err = qlDelete(tx, stmt)
+		default:
+			panic("unreachable")
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func qlSelect(tx *DBTX, stmt *QLSelect) (*QLResult, error) {
+	tdef := getTableDef(tx, stmt.Table)
+	if tdef == nil {
+		return nil, fmt.Errorf("table not found: %s", stmt.Table)
+	}
+	names := stmt.Names
+	if names == nil {
+		names = tdef.Cols
+	}
+	for _, name := range append([]string{stmt.OrderBy}, names...) {
+		if name != "" && colIndex(tdef, name) < 0 {
+			return nil, fmt.Errorf("unknown column: %s", name)
+		}
+	}
+	// the scan order satisfies the ORDER BY if it is on the scanned column
+	sc, col := qlScanInit(tdef, stmt.Filter, stmt.OrderBy, stmt.Desc)
+	sorted := stmt.OrderBy == "" || stmt.OrderBy == col
+	// only decode the selected columns
+	sc.Cols = names
+	if stmt.OrderBy != "" {
+		sc.Cols = append([]string{stmt.OrderBy}, names...)
+	}
+	scan := stmt.QLScan
+	if !sorted {
+		// sort everything before applying the limit
+		scan.Offset, scan.Limit = 0, -1
+	}
+	rows, err := qlScanRows(tx, tdef, &sc, &scan)
+	if err != nil {
+		return nil, err
+	}
+	if !sorted {
+		sort.SliceStable(rows, func(i, j int) bool {
+			r := qlCompare(*rows[i].Get(stmt.OrderBy), *rows[j].Get(stmt.OrderBy))
+			if stmt.Desc {
+				return r > 0
+			}
+			return r < 0
+		})
+		rows = qlLimit(rows, stmt.Offset, stmt.Limit)
+	}
+	// projection
+	out := &QLResult{Cols: names}
+	for _, row := range rows {
+		rec := Record{}
+		for _, name := range names {
+			rec.Cols = append(rec.Cols, name)
+			rec.Vals = append(rec.Vals, *row.Get(name))
+		}
+		out.Rows = append(out.Rows, rec)
+	}
+	return out, nil
+}
+
+func qlLimit(rows []Record, offset int64, limit int64) []Record {
+	if offset >= int64(len(rows)) {
+		return nil
+	}
+	rows = rows[offset:]
+	if limit >= 0 && limit < int64(len(rows)) {
+		rows = rows[:limit]
+	}
+	return rows
+}
+
+func qlInsert(tx *DBTX, stmt *QLInsert) (*QLResult, error) {
+	tdef := getTableDef(tx, stmt.Table)
+	if tdef == nil {
+		return nil, fmt.Errorf("table not found: %s", stmt.Table)
+	}
+	names := stmt.Names
+	if names == nil {
+		names = tdef.Cols
+	}
+	out := &QLResult{}
+	for _, row := range stmt.Values {
+		if len(row) != len(names) {
+			return out, fmt.Errorf("expect %d values, got %d", len(names), len(row))
+		}
+		rec := Record{}
+		for i, expr := range row {
+			val, err := qlEval(&Record{}, expr)
+			if err != nil {
+				return out, err
+			}
+			rec.Cols = append(rec.Cols, names[i])
+			rec.Vals = append(rec.Vals, val)
+		}
+		if _, err := dbUpdate(tx, tdef, rec, stmt.Mode); err != nil {
+			return out, err
+		}
+		out.Affected++
+	}
+	return out, nil
+}
+
+func qlUpdate(tx *DBTX, stmt *QLUpdate) (*QLResult, error) {
+	tdef := getTableDef(tx, stmt.Table)
+	if tdef == nil {
+		return nil, fmt.Errorf("table not found: %s", stmt.Table)
+	}
+	for _, name := range stmt.Names {
+		idx := colIndex(tdef, name)
+		if idx < 0 {
+			return nil, fmt.Errorf("unknown column: %s", name)
+		}
+		if idx < tdef.PKeys {
+			return nil, fmt.Errorf("cannot update the primary key: %s", name)
+		}
+	}
+	sc, _ := qlScanInit(tdef, stmt.Filter, "", false)
+	rows, err := qlScanRows(tx, tdef, &sc, &stmt.QLScan)
+	if err != nil {
+		return nil, err
+	}
+	// evaluate every row before writing anything back
+	updated := make([]Record, len(rows))
+	for i, row := range rows {
+		updated[i] = Record{Cols: row.Cols, Vals: append([]Value{}, row.Vals...)}
+		for j, name := range stmt.Names {
+			val, err := qlEval(&row, stmt.Values[j])
+			if err != nil {
+				return nil, err
+			}
+			if val.Type != tdef.Types[colIndex(tdef, name)] {
+				return nil, fmt.Errorf("type mismatch for column: %s", name)
+			}
+			*updated[i].Get(name) = val
+		}
+	}
+	out := &QLResult{}
+	for _, rec := range updated {
+		if _, err := dbUpdate(tx, tdef, rec, MODE_UPDATE_ONLY); err != nil {
+			return out, err
+		}
+		out.Affected++
+	}
+	return out, nil
+}
+
+func qlDelete(tx *DBTX, stmt *QLDelete) (*QLResult, error) {
+	tdef := getTableDef(tx, stmt.Table)
+	if tdef == nil {
+		return nil, fmt.Errorf("table not found: %s", stmt.Table)
+	}
+	sc, _ := qlScanInit(tdef, stmt.Filter, "", false)
+	rows, err := qlScanRows(tx, tdef, &sc, &stmt.QLScan)
+	if err != nil {
+		return nil, err
+	}
+	out := &QLResult{}
+	for _, row := range rows {
+		pk := Record{Cols: row.Cols[:tdef.PKeys], Vals: row.Vals[:tdef.PKeys]}
+		if _, err := dbDelete(tx, tdef, pk); err != nil {
+			return out, err
+		}
+		out.Affected++
+	}
+	return out, nil
+}
+
+// collect the rows matching the filter, the offset and the limit
+func qlScanRows(tx *DBTX, tdef *TableDef, sc *Scanner, scan *QLScan) ([]Record, error) {
+	sc.Filter = scan.Filter // evaluated by the scanner
+	if err := dbScan(tx, tdef, sc); err != nil {
+		return nil, err
+	}
+	rows := []Record{}
+	skip := scan.Offset
+	for ; sc.Valid() && (scan.Limit < 0 || int64(len(rows)) < scan.Limit); sc.Next() {
+		if skip > 0 {
+			skip--
+			continue
+		}
+		rec := Record{}
+		sc.Deref(&rec)
+		rows = append(rows, rec)
+	}
+	return rows, sc.Err()
+}
+
+// a bound on a column extracted from the filter
+type qlBound struct {
+	cmp int
+	val Value
+}
+
+// Turn the filter into a range on the primary key or an index, so that
+// only part of the table is scanned. The filter is still evaluated on
+// every row, the range only narrows the scan. Returns the scanner and the
+// column that the scan is ordered by.
+func qlScanInit(tdef *TableDef, filter QLNode, orderBy string, desc bool) (Scanner, string) {
+	// collect the bounds from the top-level conjunctions
+	bounds := map[string][]qlBound{}
+	for _, cond := range qlConjuncts(filter) {
+		if col, bound, ok := qlColumnBound(tdef, cond); ok {
+			bounds[col] = append(bounds[col], bound)
+		}
+	}
+	// candidates: the leading column of the primary key and of each index
+	candidates := []string{tdef.Cols[0]}
+	for _, index := range tdef.Indexes {
+		candidates = append(candidates, index[0])
+	}
+	col := ""
+	for _, c := range candidates {
+		if len(bounds[c]) > 0 {
+			col = c
+			break
+		}
+	}
+	if col == "" {
+		// full table scan in the primary key order
+		sc := Scanner{Cmp1: CMP_GE, Cmp2: CMP_LE}
+		if desc && orderBy == tdef.Cols[0] {
+			sc.Cmp1, sc.Cmp2 = CMP_LE, CMP_GE
+		}
+		return sc, tdef.Cols[0]
+	}
+	// the tightest lower and upper bounds
+	var lo, hi *qlBound
+	for i := range bounds[col] {
+		b := &bounds[col][i]
+		if b.cmp == QL_CMP_EQ || b.cmp == QL_CMP_GE || b.cmp == QL_CMP_GT {
+			if lo == nil || qlTighter(b, lo, 1) {
+				lo = b
+			}
+		}
+		if b.cmp == QL_CMP_EQ || b.cmp == QL_CMP_LE || b.cmp == QL_CMP_LT {
+			if hi == nil || qlTighter(b, hi, -1) {
+				hi = b
+			}
+		}
+	}
+	// the lower end of the range
+	loCmp, loKey := CMP_GE, Record{}
+	if lo != nil {
+		loKey.Cols = []string{col}
+		loKey.Vals = []Value{lo.val}
+		if lo.cmp == QL_CMP_GT {
+			loCmp = CMP_GT
+		}
+	}
+	// the upper end of the range
+	hiCmp, hiKey := CMP_LE, Record{}
+	if hi != nil {
+		hiKey.Cols = []string{col}
+		hiKey.Vals = []Value{hi.val}
+		if hi.cmp == QL_CMP_LT {
+			hiCmp = CMP_LT
+		}
+	}
+	if desc && orderBy == col {
+		return Scanner{Cmp1: hiCmp, Key1: hiKey, Cmp2: loCmp, Key2: loKey}, col
+	}
+	return Scanner{Cmp1: loCmp, Key1: loKey, Cmp2: hiCmp, Key2: hiKey}, col
+}
+
+// is bound a tighter than bound b? dir is 1 for lower bounds, -1 for upper bounds.
+func qlTighter(a *qlBound, b *qlBound, dir int) bool {
+	r := qlCompare(a.val, b.val) * dir
+	if r != 0 {
+		return r > 0
+	}
+	// `x > v` is tighter than `x >= v`
+	return a.cmp == QL_CMP_GT || a.cmp == QL_CMP_LT
+}
+
+// split `a AND b AND c` into its terms
+func qlConjuncts(node QLNode) []QLNode {
+	switch node.Type {
+	case QL_UNINIT:
+		return nil
+	case QL_AND:
+		return append(qlConjuncts(node.Kids[0]), qlConjuncts(node.Kids[1])...)
+	default:
+		return []QLNode{node}
+	}
+}
+
+// match `col op literal` or `literal op col` on a column of the same type
+func qlColumnBound(tdef *TableDef, cond QLNode) (string, qlBound, bool) {
+	flip := map[uint32]uint32{
+		QL_CMP_GE: QL_CMP_LE, QL_CMP_GT: QL_CMP_LT,
+		QL_CMP_LE: QL_CMP_GE, QL_CMP_LT: QL_CMP_GT,
+		QL_CMP_EQ: QL_CMP_EQ,
+	}
+	if _, ok := flip[cond.Type]; !ok {
+		return "", qlBound{}, false
+	}
+	sym, lit, cmp := cond.Kids[0], cond.Kids[1], cond.Type
+	if sym.Type != QL_SYM {
+		sym, lit, cmp = lit, sym, flip[cmp]
+	}
+	if sym.Type != QL_SYM || (lit.Type != QL_STR && lit.Type != QL_I64) {
+		return "", qlBound{}, false
+	}
+	col := string(sym.Str)
+	idx := colIndex(tdef, col)
+	if idx < 0 || tdef.Types[idx] != lit.Type {
+		return "", qlBound{}, false
+	}
+	return col, qlBound{cmp: int(cmp), val: lit.Value}, true
+}
+
+func qlCompare(a Value, b Value) int {
+	if a.Type == TYPE_INT64 {
+		switch {
+		case a.I64 < b.I64:
+			return -1
+		case a.I64 > b.I64:
+			return 1
+		}
+		return 0
+	}
+	return bytes.Compare(a.Str, b.Str)
+}
+
+func qlBool(b bool) Value {
+	if b {
+		return Value{Type: QL_I64, I64: 1}
+	}
+	return Value{Type: QL_I64, I64: 0}
+}
+
+// the columns referenced by an expression
+func qlSymbols(node QLNode) []string {
+	if node.Type == QL_SYM {
+		return []string{string(node.Str)}
+	}
+	out := []string{}
+	for _, kid := range node.Kids {
+		out = append(out, qlSymbols(kid)...)
+	}
+	return out
+}
+
+// evaluate an expression against a row
+func qlEval(rec *Record, node QLNode) (Value, error) {
+	switch node.Type {
+	case QL_STR, QL_I64:
+		return node.Value, nil
+	case QL_SYM:
+		val := rec.Get(string(node.Str))
+		if val.Type == TYPE_ERROR {
+			return Value{}, fmt.Errorf("unknown column: %s", node.Str)
+		}
+		return *val, nil
+	case QL_NOT, QL_NEG:
+		kid, err := qlEval(rec, node.Kids[0])
+		if err != nil {
+			return kid, err
+		}
+		if kid.Type != QL_I64 {
+			return Value{}, fmt.Errorf("expect integer operand")
+		}
+		if node.Type == QL_NOT {
+			return qlBool(kid.I64 == 0), nil
+		}
+		return Value{Type: QL_I64, I64: -kid.I64}, nil
+	}
+	left, err := qlEval(rec, node.Kids[0])
+	if err != nil {
+		return left, err
+	}
+	right, err := qlEval(rec, node.Kids[1])
+	if err != nil {
+		return right, err
+	}
+	if left.Type != right.Type {
+		return Value{}, fmt.Errorf("type mismatch")
+	}
+	switch node.Type {
+	case QL_CMP_GE:
+		return qlBool(qlCompare(left, right) >= 0), nil
+	case QL_CMP_GT:
+		return qlBool(qlCompare(left, right) > 0), nil
+	case QL_CMP_LT:
+		return qlBool(qlCompare(left, right) < 0), nil
+	case QL_CMP_LE:
+		return qlBool(qlCompare(left, right) <= 0), nil
+	case QL_CMP_EQ:
+		return qlBool(qlCompare(left, right) == 0), nil
+	case QL_CMP_NE:
+		return qlBool(qlCompare(left, right) != 0), nil
+	}
+	if left.Type != QL_I64 {
+		return Value{}, fmt.Errorf("expect integer operands")
+	}
+	switch node.Type {
+	case QL_ADD:
+		return Value{Type: QL_I64, I64: left.I64 + right.I64}, nil
+	case QL_SUB:
+		return Value{Type: QL_I64, I64: left.I64 - right.I64}, nil
+	case QL_AND:
+		return qlBool(left.I64 != 0 && right.I64 != 0), nil
+	case QL_OR:
+		return qlBool(left.I64 != 0 || right.I64 != 0), nil
+	}
+	panic("unreachable")
+}
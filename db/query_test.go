@@ -0,0 +1,125 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+)
+
+func newTestDB(t *testing.T) *DB {
+	db := &DB{Path: t.TempDir() + "/test.db"}
+	if err := db.Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+	return db
+}
+
+func qlExec(t *testing.T, db *DB, query string) *QLResult {
+	res, err := db.Exec(query)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return res
+}
+
+// the rows as strings, for comparing
+func qlRows(res *QLResult) []string {
+	out := []string{}
+	for _, rec := range res.Rows {
+		row := ""
+		for i, v := range rec.Vals {
+			if i > 0 {
+				row += ","
+			}
+			if v.Type == TYPE_INT64 {
+				row += fmt.Sprint(v.I64)
+			} else {
+				row += string(v.Str)
+			}
+		}
+		out = append(out, row)
+	}
+	return out
+}
+
+func expectRows(t *testing.T, res *QLResult, rows ...string) {
+	got := qlRows(res)
+	if fmt.Sprint(got) != fmt.Sprint(rows) {
+		t.Errorf("got %v, want %v", got, rows)
+	}
+}
+
+func TestQLParse(t *testing.T) {
+	stmt, err := ParseQL("SELECT key,value FROM key_value WHERE key >= 'a' AND key < 'b' LIMIT 10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sel := stmt.(*QLSelect)
+	if sel.Table != "key_value" || len(sel.Names) != 2 || sel.Limit != 10 || sel.Filter.Type != QL_AND {
+		t.Errorf("bad select: %+v", sel)
+	}
+	for _, bad := range []string{
+		"SELECT FROM t",
+		"SELECT * FROM t WHERE",
+		"SELECT * FROM t LIMIT x",
+		"INSERT INTO t VALUES ('a'",
+		"UPDATE t SET WHERE a = 1",
+		"DROP TABLE t",
+		"SELECT * FROM t WHERE a = 'unterminated",
+	} {
+		if _, err := ParseQL(bad); err == nil {
+			t.Errorf("expect an error: %s", bad)
+		}
+	}
+}
+
+func TestQLExec(t *testing.T) {
+	db := newTestDB(t)
+	err := db.TableNew(&TableDef{
+		Name:    "kv",
+		Types:   []uint32{TYPE_BYTES, TYPE_BYTES, TYPE_INT64},
+		Cols:    []string{"key", "owner", "size"},
+		PKeys:   1,
+		Indexes: [][]string{{"owner"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := qlExec(t, db, "INSERT INTO kv (key, owner, size) VALUES "+
+		"('a1', 'bob', 1), ('a2', 'alice', 2), ('b1', 'bob', 3), ('c1', 'carol', 4)")
+	if res.Affected != 4 {
+		t.Errorf("affected %d", res.Affected)
+	}
+	if _, err := db.Exec("INSERT INTO kv VALUES ('a1', 'bob', 1)"); err == nil {
+		t.Errorf("expect a duplicated key error")
+	}
+
+	// range on the primary key
+	expectRows(t, qlExec(t, db, "SELECT key FROM kv WHERE key >= 'a' AND key < 'b'"), "a1", "a2")
+	expectRows(t, qlExec(t, db, "SELECT key FROM kv WHERE key > 'a1'"), "a2", "b1", "c1")
+	expectRows(t, qlExec(t, db, "SELECT key FROM kv WHERE 'b1' >= key ORDER BY key DESC"), "b1", "a2", "a1")
+	// range on the index
+	expectRows(t, qlExec(t, db, "SELECT key, size FROM kv WHERE owner = 'bob'"), "a1,1", "b1,3")
+	// other filters, order, limit
+	expectRows(t, qlExec(t, db, "SELECT key FROM kv WHERE size >= 2 AND NOT owner = 'bob'"), "a2", "c1")
+	expectRows(t, qlExec(t, db, "SELECT key FROM kv ORDER BY size DESC LIMIT 2 OFFSET 1"), "b1", "a2")
+	expectRows(t, qlExec(t, db, "SELECT * FROM kv WHERE owner = 'carol' OR size = 1"), "a1,bob,1", "c1,carol,4")
+
+	// updates move the index keys
+	res = qlExec(t, db, "UPDATE kv SET owner = 'dave', size = size + 10 WHERE owner = 'bob'")
+	if res.Affected != 2 {
+		t.Errorf("affected %d", res.Affected)
+	}
+	expectRows(t, qlExec(t, db, "SELECT key FROM kv WHERE owner = 'bob'"))
+	expectRows(t, qlExec(t, db, "SELECT key, size FROM kv WHERE owner = 'dave'"), "a1,11", "b1,13")
+	if _, err := db.Exec("UPDATE kv SET key = 'x'"); err == nil {
+		t.Errorf("expect an error for updating the primary key")
+	}
+
+	res = qlExec(t, db, "DELETE FROM kv WHERE owner = 'dave'")
+	if res.Affected != 2 {
+		t.Errorf("affected %d", res.Affected)
+	}
+	expectRows(t, qlExec(t, db, "SELECT key FROM kv"), "a2", "c1")
+	expectRows(t, qlExec(t, db, "SELECT key FROM kv WHERE owner >= 'a'"), "a2", "c1")
+}
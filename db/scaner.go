@@ -13,24 +13,41 @@ type Scanner struct {
 	Cmp2 int
 	Key1 Record
 	Key2 Record
+	// optional
+	Cols   []string // the columns to fetch, all columns if empty
+	Filter QLNode   // skip the rows that the expression is false
 	// internal
-	tdef   *TableDef
-	iter   *BIter // the underlying B-tree iterator
-	keyEnd []byte // the encoded Key2
+	tx      *DBTX
+	tdef    *TableDef
+	index   int    // -1: use the primary key; >= 0: use an index
+	iter    *BIter // the underlying B-tree iterator
+	keyEnd  []byte // the encoded Key2
+	want    []bool // the columns to decode, by tdef.Cols
+	covered bool   // the index contains all the wanted columns
+	err     error  // from the filter
 }
 
 // within the range or not?
 func (sc *Scanner) Valid() bool {
-	if !sc.iter.Valid() {
+	if sc.err != nil || !sc.iter.Valid() {
 		return false
 	}
 	key, _ := sc.iter.Deref()
 	return CmpOK(key, sc.Cmp2, sc.keyEnd)
 }
 
+// the filter error that stopped the scan
+func (sc *Scanner) Err() error {
+	return sc.err
+}
+
 // move the underlying B-tree iterator
 func (sc *Scanner) Next() {
 	Assert(sc.Valid())
+	sc.step()
+	sc.skip()
+}
+func (sc *Scanner) step() {
 	if sc.Cmp1 > 0 {
 		sc.iter.Next()
 	} else {
@@ -38,32 +55,121 @@ func (sc *Scanner) Next() {
 	}
 }
 
-// fetch the current row
-func (sc *Scanner) Deref(rec *Record) {
-	values, err := checkRecord(sc.tdef, *rec, sc.tdef.PKeys)
-	if err != nil {
+// move past the rows that don't satisfy the filter
+func (sc *Scanner) skip() {
+	if sc.Filter.Type == QL_UNINIT {
 		return
 	}
-	// key := encodeKey(nil, sc.tdef.Prefix, values[:sc.tdef.PKeys])
-	// fmt.Println("prefix", sc.tdef.Prefix, "values:", values[:sc.tdef.PKeys], "record", rec)
-	// fmt.Printf("serach for key: %s\n", key)
-	_, val := sc.iter.Deref()
+	for ; sc.Valid(); sc.step() {
+		rec := sc.fetch()
+		val, err := qlEval(&rec, sc.Filter)
+		if err != nil {
+			sc.err = err
+			return
+		}
+		if val.Type == QL_I64 && val.I64 != 0 {
+			return
+		}
+	}
+}
 
-	for i := sc.tdef.PKeys; i < len(sc.tdef.Cols); i++ {
-		values[i].Type = sc.tdef.Types[i]
+// fetch the current row, only the columns in Cols
+func (sc *Scanner) Deref(rec *Record) {
+	Assert(sc.Valid())
+	row := sc.fetch()
+	cols := sc.Cols
+	if len(cols) == 0 {
+		cols = sc.tdef.Cols
+	}
+	*rec = Record{}
+	for _, c := range cols {
+		rec.Cols = append(rec.Cols, c)
+		rec.Vals = append(rec.Vals, *row.Get(c))
 	}
-	decodeValues(val, values[sc.tdef.PKeys:])
-	rec.Cols = append(rec.Cols, sc.tdef.Cols[sc.tdef.PKeys:]...)
-	rec.Vals = append(rec.Vals, values[sc.tdef.PKeys:]...)
 }
-func (db *DB) Scan(table string, req *Scanner) error {
-	tdef := getTableDef(db, table)
-	if tdef == nil {
-		return fmt.Errorf("table not found: %s", table)
+
+// decode the wanted columns of the current row
+func (sc *Scanner) fetch() Record {
+	tdef := sc.tdef
+	key, val := sc.iter.Deref()
+	values := make([]Value, len(tdef.Cols))
+	for i := range values {
+		values[i].Type = tdef.Types[i]
+	}
+	if sc.index < 0 {
+		// primary key, decode the KV pair
+		decodeWanted(key[4:], values[:tdef.PKeys], sc.want[:tdef.PKeys])
+		decodeWanted(val, values[tdef.PKeys:], sc.want[tdef.PKeys:])
+		return wantedRecord(tdef, values, sc.want)
+	}
+	// secondary index, decode the index key first
+	Assert(len(val) == 0)
+	index := tdef.Indexes[sc.index]
+	ivals := make([]Value, len(index))
+	for i, c := range index {
+		ivals[i].Type = tdef.Types[colIndex(tdef, c)]
+	}
+	decodeValues(key[4:], ivals)
+	for i, c := range index {
+		values[colIndex(tdef, c)] = ivals[i]
 	}
-	return dbScan(db, tdef, req)
+	if sc.covered {
+		return wantedRecord(tdef, values, sc.want)
+	}
+	// then fetch the row by the primary key
+	pk := &Record{Cols: tdef.Cols[:tdef.PKeys], Vals: values[:tdef.PKeys]}
+	ok, err := dbGet(sc.tx, tdef, pk)
+	Assert(ok && err == nil)
+	return *pk
+}
+
+// the columns needed by the projection and the filter
+func (sc *Scanner) wanted() error {
+	tdef := sc.tdef
+	sc.want = make([]bool, len(tdef.Cols))
+	cols := append([]string{}, sc.Cols...)
+	if len(cols) == 0 {
+		cols = tdef.Cols
+	}
+	cols = append(cols, qlSymbols(sc.Filter)...)
+	for _, c := range cols {
+		idx := colIndex(tdef, c)
+		if idx < 0 {
+			return fmt.Errorf("unknown column: %s", c)
+		}
+		sc.want[idx] = true
+	}
+	sc.covered = sc.index >= 0
+	for i, c := range tdef.Cols {
+		if sc.want[i] && sc.covered && !inCols(tdef.Indexes[sc.index], c) {
+			sc.covered = false
+		}
+	}
+	return nil
+}
+func inCols(cols []string, col string) bool {
+	for _, c := range cols {
+		if c == col {
+			return true
+		}
+	}
+	return false
+}
+func wantedRecord(tdef *TableDef, values []Value, want []bool) Record {
+	rec := Record{}
+	for i, c := range tdef.Cols {
+		if want[i] {
+			rec.Cols = append(rec.Cols, c)
+			rec.Vals = append(rec.Vals, values[i])
+		}
+	}
+	return rec
+}
+
+func (db *DB) Scan(table string, req *Scanner) error {
+	return db.reader().Scan(table, req)
 }
-func dbScan(db *DB, tdef *TableDef, req *Scanner) error {
+func dbScan(tx *DBTX, tdef *TableDef, req *Scanner) error {
 	// sanity checks
 	switch {
 	case req.Cmp1 > 0 && req.Cmp2 < 0:
@@ -71,18 +177,126 @@ func dbScan(db *DB, tdef *TableDef, req *Scanner) error {
 	default:
 		return fmt.Errorf("bad range")
 	}
-	values1, err := checkRecord(tdef, req.Key1, tdef.PKeys)
+	// select the primary key or an index by the range columns,
+	// the range keys can be different prefixes of the same index.
+	cols := req.Key1.Cols
+	if len(req.Key2.Cols) > len(cols) {
+		cols = req.Key2.Cols
+	}
+	index, err := findIndex(tdef, cols)
+	if err != nil {
+		return err
+	}
+	keys, prefix := tdef.Cols[:tdef.PKeys], tdef.Prefix
+	if index >= 0 {
+		keys, prefix = tdef.Indexes[index], tdef.IndexPrefixes[index]
+	}
+	if !isPrefix(keys, req.Key1.Cols) || !isPrefix(keys, req.Key2.Cols) {
+		return fmt.Errorf("bad range key")
+	}
+	values1, err := checkKeyPrefix(tdef, keys, req.Key1)
 	if err != nil {
 		return err
 	}
-	values2, err := checkRecord(tdef, req.Key2, tdef.PKeys)
+	values2, err := checkKeyPrefix(tdef, keys, req.Key2)
 	if err != nil {
 		return err
 	}
+	req.tx = tx
 	req.tdef = tdef
+	req.index = index
 	// seek to the start key
-	keyStart := encodeKey(nil, tdef.Prefix, values1[:tdef.PKeys])
-	req.keyEnd = encodeKey(nil, tdef.Prefix, values2[:tdef.PKeys])
-	req.iter = db.kv.GetTree().Seek(keyStart, req.Cmp1)
-	return nil
+	keyStart := encodeKeyPartial(nil, prefix, values1, tdef, keys, req.Cmp1)
+	req.keyEnd = encodeKeyPartial(nil, prefix, values2, tdef, keys, req.Cmp2)
+	req.iter = tx.kv.Seek(keyStart, req.Cmp1)
+	req.err = nil
+	if err := req.wanted(); err != nil {
+		return err
+	}
+	req.skip()
+	return req.err
+}
+
+// pick the primary key or the shortest index that starts with the range columns.
+// empty range keys are a full table scan over the primary key.
+func findIndex(tdef *TableDef, keys []string) (int, error) {
+	if isPrefix(tdef.Cols[:tdef.PKeys], keys) {
+		return -1, nil
+	}
+	winner := -2
+	for i, index := range tdef.Indexes {
+		if !isPrefix(index, keys) {
+			continue
+		}
+		if winner == -2 || len(index) < len(tdef.Indexes[winner]) {
+			winner = i
+		}
+	}
+	if winner == -2 {
+		return -2, fmt.Errorf("no index found for %v", keys)
+	}
+	return winner, nil
+}
+
+// the columns are the leading columns of the index, in any order
+func isPrefix(index []string, cols []string) bool {
+	if len(cols) > len(index) {
+		return false
+	}
+	return sameCols(index[:len(cols)], cols)
+}
+func sameCols(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := map[string]bool{}
+	for _, c := range a {
+		set[c] = true
+	}
+	for _, c := range b {
+		if !set[c] {
+			return false
+		}
+	}
+	return true
+}
+
+// order the range key by the index columns and check the types
+func checkKeyPrefix(tdef *TableDef, keys []string, rec Record) ([]Value, error) {
+	values := make([]Value, len(rec.Cols))
+	for i := range values {
+		values[i] = *rec.Get(keys[i])
+		if values[i].Type != tdef.Types[colIndex(tdef, keys[i])] {
+			return nil, fmt.Errorf("invalid type for column: %s", keys[i])
+		}
+	}
+	return values, nil
+}
+
+// The range key can be a prefix of the index key,
+// the missing columns are encoded as either the minimum or the maximum,
+// depending on the comparison operator.
+//  1. The empty string is lower than all possible value encodings,
+//     thus nothing is added for CMP_LT and CMP_GE.
+//  2. The maximum encodings are all 0xff bytes, 0xff never appears
+//     in UTF-8 text.
+func encodeKeyPartial(
+	out []byte, prefix uint32, values []Value,
+	tdef *TableDef, keys []string, cmp int,
+) []byte {
+	out = encodeKey(out, prefix, values)
+	max := cmp == CMP_GT || cmp == CMP_LE
+loop:
+	for i := len(values); max && i < len(keys); i++ {
+		switch tdef.Types[colIndex(tdef, keys[i])] {
+		case TYPE_BYTES:
+			out = append(out, 0xff)
+			break loop // stops here since no key string starts with 0xff
+		case TYPE_INT64:
+			out = append(out, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+		default:
+			panic("what?")
+		}
+	}
+	return out
 }
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+	. "types"
+)
+
+func TestScanAggregate(t *testing.T) {
+	db := newTestDB(t)
+	err := db.TableNew(&TableDef{
+		Name:    "kv",
+		Types:   []uint32{TYPE_BYTES, TYPE_BYTES, TYPE_INT64},
+		Cols:    []string{"key", "owner", "size"},
+		PKeys:   1,
+		Indexes: [][]string{{"owner"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	qlExec(t, db, "INSERT INTO kv VALUES ('a1', 'bob', 1), ('a2', 'alice', 2), "+
+		"('b1', 'bob', 3), ('c1', 'carol', 4), ('c2', 'bob', 5)")
+
+	// projection and filter
+	sc := Scanner{Cmp1: CMP_GE, Cmp2: CMP_LE, Cols: []string{"size", "key"}}
+	sc.Filter, err = ParseExpr("size > 1 AND owner = 'bob'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Scan("kv", &sc); err != nil {
+		t.Fatal(err)
+	}
+	expectRows(t, scanAll(&sc), "3,b1", "5,c2")
+
+	// covered by the index, the rows are not fetched
+	sc = Scanner{
+		Cmp1: CMP_GE, Cmp2: CMP_LE, Cols: []string{"key"},
+		Key1: *(&Record{}).AddStr("owner", []byte("bob")),
+		Key2: *(&Record{}).AddStr("owner", []byte("bob")),
+	}
+	if err := db.Scan("kv", &sc); err != nil {
+		t.Fatal(err)
+	}
+	if !sc.covered {
+		t.Errorf("expect a covering index")
+	}
+	expectRows(t, scanAll(&sc), "a1", "b1", "c2")
+
+	sc = Scanner{Cmp1: CMP_GE, Cmp2: CMP_LE, Cols: []string{"nope"}}
+	if err := db.Scan("kv", &sc); err == nil {
+		t.Errorf("expect an unknown column error")
+	}
+
+	// keys per owner
+	rows, err := db.Aggregate("kv", &AggReq{
+		Scanner: Scanner{Cmp1: CMP_GE, Cmp2: CMP_LE},
+		GroupBy: []string{"owner"},
+		Aggs: []Aggregate{
+			{Func: AGG_COUNT},
+			{Func: AGG_SUM, Col: "size"},
+			{Func: AGG_MIN, Col: "key"},
+			{Func: AGG_MAX, Col: "size"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectRows(t, &QLResult{Rows: rows}, "alice,1,2,a2,2", "bob,3,9,a1,5", "carol,1,4,c1,4")
+	if fmt.Sprint(rows[0].Cols) != "[owner count sum(size) min(key) max(size)]" {
+		t.Errorf("bad columns: %v", rows[0].Cols)
+	}
+
+	// no group, nothing matches
+	req := &AggReq{
+		Scanner: Scanner{Cmp1: CMP_GE, Cmp2: CMP_LE},
+		Aggs:    []Aggregate{{Func: AGG_COUNT}},
+	}
+	req.Filter, _ = ParseExpr("size > 100")
+	rows, err = db.Aggregate("kv", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectRows(t, &QLResult{Rows: rows}, "0")
+
+	_, err = db.Aggregate("kv", &AggReq{
+		Scanner: Scanner{Cmp1: CMP_GE, Cmp2: CMP_LE},
+		Aggs:    []Aggregate{{Func: AGG_SUM, Col: "owner"}},
+	})
+	if err == nil {
+		t.Errorf("expect an error for the sum of strings")
+	}
+}
+
+func scanAll(sc *Scanner) *QLResult {
+	res := &QLResult{}
+	for ; sc.Valid(); sc.Next() {
+		rec := Record{}
+		sc.Deref(&rec)
+		res.Rows = append(res.Rows, rec)
+	}
+	return res
+}
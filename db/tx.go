@@ -19,12 +19,14 @@ type KVTX struct {
 
 // DB transaction
 type DBTX struct {
-	kv KVTX
-	db *DB
+	kv      KVTX
+	db      *DB
+	changes []Change // captured for the change feed
 }
 
-// begin a transaction
+// begin a transaction, there is only one writer at a time.
 func (kv *KV) Begin(tx *KVTX) {
+	kv.writer.Lock()
 	// save root and head
 	tx.db = kv
 	tx.tree.root = kv.tree.Root
@@ -41,9 +43,9 @@ func rollbackTX(tx *KVTX) {
 	kv.page.updates = map[uint64][]byte{}
 }
 
-// end a transaction: commit updates
 // end a transaction: commit updates
 func (kv *KV) Commit(tx *KVTX) error {
+	defer kv.writer.Unlock()
 	if kv.tree.Root == tx.tree.root {
 		return nil // no updates?
 	}
@@ -78,17 +80,33 @@ func (kv *KV) Commit(tx *KVTX) error {
 
 // end a transaction: rollback
 func (kv *KV) Abort(tx *KVTX) {
+	defer kv.writer.Unlock()
 	rollbackTX(tx)
 }
 func (db *DB) Begin(tx *DBTX) {
 	tx.db = db
+	tx.changes = nil
 	db.kv.Begin(&tx.kv)
 }
 func (db *DB) Commit(tx *DBTX) error {
-	return db.kv.Commit(&tx.kv)
+	// the changes are delivered in the commit order
+	db.feed.mu.Lock()
+	defer db.feed.mu.Unlock()
+	if err := logChanges(tx); err != nil {
+		db.Abort(tx)
+		return err
+	}
+	err := db.kv.Commit(&tx.kv)
+	if err != nil {
+		db.tables = nil
+		return err
+	}
+	db.feed.publish(tx.changes)
+	return nil
 }
 func (db *DB) Abort(tx *DBTX) {
 	db.kv.Abort(&tx.kv)
+	db.tables = nil // may have cached a table created in this transaction
 }
 
 // KV operations
@@ -102,12 +120,67 @@ func (tx *KVTX) Update(req *InsertReq) bool {
 	tx.db.tree.InsertEx(req)
 	return req.Added
 }
+func (tx *KVTX) Del(req *DeleteReq) bool {
+	return tx.db.tree.DeleteEx(req)
+}
 
-//	func (tx *KVTX) Del(req *DeleteReq) bool {
-//		return tx.db.tree.DeleteEx(req)
-//	}
-// func (tx *DBTX) TableNew(tdef *TableDef) error
-// func (tx *DBTX) Get(table string, rec *Record) (bool, error)
-// func (tx *DBTX) Set(table string, rec Record, mode int) (bool, error)
-// func (tx *DBTX) Delete(table string, rec Record) (bool, error)
-// func (tx *DBTX) Scan(table string, req *Scanner) error
+// DB operations within a transaction
+func (tx *DBTX) TableNew(tdef *TableDef) error {
+	return dbTableNew(tx, tdef)
+}
+func (tx *DBTX) Get(table string, rec *Record) (bool, error) {
+	tdef := getTableDef(tx, table)
+	if tdef == nil {
+		return false, fmt.Errorf("table not found: %s", table)
+	}
+	return dbGet(tx, tdef, rec)
+}
+func (tx *DBTX) Set(table string, rec Record, mode int) (bool, error) {
+	tdef := getTableDef(tx, table)
+	if tdef == nil {
+		return false, fmt.Errorf("table not found: %s", table)
+	}
+	return dbUpdate(tx, tdef, rec, mode)
+}
+func (tx *DBTX) Insert(table string, rec Record) (bool, error) {
+	return tx.Set(table, rec, MODE_INSERT_ONLY)
+}
+func (tx *DBTX) Update(table string, rec Record) (bool, error) {
+	return tx.Set(table, rec, MODE_UPDATE_ONLY)
+}
+func (tx *DBTX) Upsert(table string, rec Record) (bool, error) {
+	return tx.Set(table, rec, MODE_UPSERT)
+}
+func (tx *DBTX) Delete(table string, rec Record) (bool, error) {
+	tdef := getTableDef(tx, table)
+	if tdef == nil {
+		return false, fmt.Errorf("table not found: %s", table)
+	}
+	return dbDelete(tx, tdef, rec)
+}
+func (tx *DBTX) Scan(table string, req *Scanner) error {
+	tdef := getTableDef(tx, table)
+	if tdef == nil {
+		return fmt.Errorf("table not found: %s", table)
+	}
+	return dbScan(tx, tdef, req)
+}
+
+// run a single write in its own transaction
+func (db *DB) update(fn func(tx *DBTX) error) error {
+	tx := DBTX{}
+	db.Begin(&tx)
+	if err := fn(&tx); err != nil {
+		db.Abort(&tx)
+		return err
+	}
+	return db.Commit(&tx)
+}
+
+// Reads outside of a transaction see the live tree, with the writes
+// of an open transaction. The caller serializes them with the writers.
+func (db *DB) reader() *DBTX {
+	tx := &DBTX{db: db}
+	tx.kv.db = db.kv
+	return tx
+}
@@ -0,0 +1,259 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestTxRollback(t *testing.T) {
+	db := newTestDB(t)
+	err := db.TableNew(&TableDef{
+		Name:  "kv",
+		Types: []uint32{TYPE_BYTES, TYPE_BYTES},
+		Cols:  []string{"k", "v"},
+		PKeys: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	qlExec(t, db, "INSERT INTO kv VALUES ('a', '1')")
+
+	tx := DBTX{}
+	db.Begin(&tx)
+	tx.Insert("kv", *(&Record{}).AddStr("k", []byte("b")).AddStr("v", []byte("2")))
+	tx.Delete("kv", *(&Record{}).AddStr("k", []byte("a")))
+	db.Abort(&tx)
+	expectRows(t, qlExec(t, db, "SELECT * FROM kv"), "a,1")
+
+	// a failed statement leaves nothing behind
+	if _, err := db.Exec("INSERT INTO kv VALUES ('c', '3'), ('a', '4')"); !errors.Is(err, ErrKeyExist) {
+		t.Errorf("expect a duplicated key error, got %v", err)
+	}
+	expectRows(t, qlExec(t, db, "SELECT * FROM kv"), "a,1")
+
+	// committed data survives reopening
+	db.Begin(&tx)
+	tx.Insert("kv", *(&Record{}).AddStr("k", []byte("b")).AddStr("v", []byte("2")))
+	if err := db.Commit(&tx); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	db.Open()
+	expectRows(t, qlExec(t, db, "SELECT * FROM kv"), "a,1", "b,2")
+}
+
+func TestConstraints(t *testing.T) {
+	db := newTestDB(t)
+	err := db.TableNew(&TableDef{
+		Name:    "users",
+		Types:   []uint32{TYPE_BYTES, TYPE_BYTES},
+		Cols:    []string{"name", "email"},
+		PKeys:   1,
+		Uniques: [][]string{{"email"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.TableNew(&TableDef{
+		Name:  "keys",
+		Types: []uint32{TYPE_BYTES, TYPE_BYTES},
+		Cols:  []string{"key", "owner"},
+		PKeys: 1,
+		Refs:  []TableRef{{Cols: []string{"owner"}, Table: "users", Cascade: true}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.TableNew(&TableDef{
+		Name:  "bad",
+		Types: []uint32{TYPE_INT64},
+		Cols:  []string{"owner"},
+		PKeys: 1,
+		Refs:  []TableRef{{Cols: []string{"owner"}, Table: "users"}},
+	})
+	if err == nil {
+		t.Errorf("expect a reference type error")
+	}
+
+	qlExec(t, db, "INSERT INTO users VALUES ('bob', 'b@x'), ('alice', 'a@x')")
+	if _, err := db.Exec("INSERT INTO users VALUES ('carol', 'b@x')"); !errors.Is(err, ErrUnique) {
+		t.Errorf("expect a unique error, got %v", err)
+	}
+	// updating a row keeps its own value
+	qlExec(t, db, "UPDATE users SET email = 'b@x' WHERE name = 'bob'")
+	if _, err := db.Exec("UPDATE users SET email = 'a@x' WHERE name = 'bob'"); !errors.Is(err, ErrUnique) {
+		t.Errorf("expect a unique error, got %v", err)
+	}
+
+	qlExec(t, db, "INSERT INTO keys VALUES ('k1', 'bob'), ('k2', 'bob'), ('k3', 'alice')")
+	if _, err := db.Exec("INSERT INTO keys VALUES ('k4', 'dave')"); !errors.Is(err, ErrForeignKey) {
+		t.Errorf("expect a foreign key error, got %v", err)
+	}
+	// cascade
+	qlExec(t, db, "DELETE FROM users WHERE name = 'bob'")
+	expectRows(t, qlExec(t, db, "SELECT key FROM keys"), "k3")
+	expectRows(t, qlExec(t, db, "SELECT name FROM users WHERE email = 'b@x'"))
+
+	// restrict
+	err = db.TableNew(&TableDef{
+		Name:  "groups",
+		Types: []uint32{TYPE_BYTES, TYPE_BYTES},
+		Cols:  []string{"group", "member"},
+		PKeys: 2,
+		Refs:  []TableRef{{Cols: []string{"member"}, Table: "users"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	qlExec(t, db, "INSERT INTO groups VALUES ('admin', 'alice')")
+	if _, err := db.Exec("DELETE FROM users WHERE name = 'alice'"); !errors.Is(err, ErrForeignKey) {
+		t.Errorf("expect a foreign key error, got %v", err)
+	}
+	expectRows(t, qlExec(t, db, "SELECT key FROM keys"), "k3")
+	qlExec(t, db, "DELETE FROM groups")
+	qlExec(t, db, "DELETE FROM users WHERE name = 'alice'")
+	expectRows(t, qlExec(t, db, "SELECT key FROM keys"))
+}
+
+func TestChangeFeed(t *testing.T) {
+	db := newTestDB(t)
+	err := db.TableNew(&TableDef{
+		Name:  "kv",
+		Types: []uint32{TYPE_BYTES, TYPE_BYTES},
+		Cols:  []string{"k", "v"},
+		PKeys: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Capture("kv")
+	got := []string{}
+	show := func(ch Change) {
+		s := fmt.Sprintf("%d:%s:%s", ch.Seq, ch.Table, ch.Key.Vals[0].Str)
+		if ch.Old != nil {
+			s += ":" + string(ch.Old.Get("v").Str)
+		}
+		if ch.New != nil {
+			s += ">" + string(ch.New.Get("v").Str)
+		}
+		got = append(got, s)
+	}
+	cancel, err := db.Subscribe(0, show)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qlExec(t, db, "INSERT INTO kv VALUES ('a', '1'), ('b', '2')")
+	db.Exec("INSERT INTO kv VALUES ('c', '3'), ('a', '4')") // rolled back
+	qlExec(t, db, "UPDATE kv SET v = '5' WHERE k = 'a'")
+	qlExec(t, db, "DELETE FROM kv WHERE k = 'b'")
+	want := "[1:kv:a>1 2:kv:b>2 3:kv:a:1>5 4:kv:b:2]"
+	if fmt.Sprint(got) != want {
+		t.Errorf("got %v, want %s", got, want)
+	}
+	cancel()
+
+	// resume after a restart
+	db.Close()
+	db.Open()
+	got = nil
+	cancel, err = db.Subscribe(3, show)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+	qlExec(t, db, "INSERT INTO kv VALUES ('d', '6')")
+	if fmt.Sprint(got) != "[3:kv:a:1>5 4:kv:b:2 5:kv:d>6]" {
+		t.Errorf("got %v", got)
+	}
+
+	if err := db.TrimChanges(5); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := db.Changes(0, 0)
+	if err != nil || len(changes) != 1 || changes[0].Seq != 5 {
+		t.Errorf("bad changes after trimming: %v %v", changes, err)
+	}
+
+	// the other tables are not logged
+	err = db.TableNew(&TableDef{Name: "secret", Types: []uint32{TYPE_BYTES}, Cols: []string{"k"}, PKeys: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	qlExec(t, db, "INSERT INTO secret VALUES ('x')")
+	if changes, _ := db.Changes(0, 0); len(changes) != 1 {
+		t.Errorf("expect no change of secret: %v", changes)
+	}
+	// the log is kept up to the slowest consumer, and whole without one
+	qlExec(t, db, "INSERT INTO kv VALUES ('e', '7')")
+	if err := db.TrimConsumed(); err != nil {
+		t.Fatal(err)
+	}
+	if changes, _ := db.Changes(0, 0); len(changes) != 2 {
+		t.Errorf("expect the changes to be kept without consumers: %v", changes)
+	}
+	db.Ack("fast", 7)
+	db.Ack("slow", 6)
+	if err := db.TrimConsumed(); err != nil {
+		t.Fatal(err)
+	}
+	if changes, _ := db.Changes(0, 0); len(changes) != 1 || changes[0].Seq != 6 {
+		t.Errorf("bad changes after the consumers: %v", changes)
+	}
+}
+
+func TestTableUpgrade(t *testing.T) {
+	db := newTestDB(t)
+	tdef := &TableDef{
+		Name:    "users",
+		Types:   []uint32{TYPE_BYTES, TYPE_BYTES},
+		Cols:    []string{"uid", "pass"},
+		PKeys:   1,
+		Indexes: [][]string{{"pass"}},
+	}
+	if err := db.TableNew(tdef); err != nil {
+		t.Fatal(err)
+	}
+	qlExec(t, db, "INSERT INTO users VALUES ('a', 'x'), ('b', 'y')")
+	more := &TableDef{
+		Name:    "users",
+		Types:   []uint32{TYPE_BYTES, TYPE_BYTES, TYPE_BYTES, TYPE_INT64},
+		Cols:    []string{"uid", "pass", "role", "locked"},
+		PKeys:   1,
+		Indexes: [][]string{{"pass"}, {"role"}},
+	}
+	if err := db.TableUpgrade(more); err != nil {
+		t.Fatal(err)
+	}
+	qlExec(t, db, "UPDATE users SET role = 'admin', locked = 1 WHERE uid = 'b'")
+	expectRows(t, qlExec(t, db, "SELECT * FROM users"), "a,x,,0", "b,y,admin,1")
+	// the old index still works, the new one has the existing rows
+	expectRows(t, qlExec(t, db, "SELECT uid FROM users WHERE pass = 'y'"), "b")
+	expectRows(t, qlExec(t, db, "SELECT uid FROM users WHERE role = ''"), "a")
+
+	// the existing rows must hold a new constraint
+	unique := *more
+	unique.Uniques = [][]string{{"locked"}}
+	qlExec(t, db, "UPDATE users SET locked = 1 WHERE uid = 'a'")
+	if err := db.TableUpgrade(&unique); !errors.Is(err, ErrUnique) {
+		t.Errorf("expect the unique to be checked: %v", err)
+	}
+	qlExec(t, db, "UPDATE users SET locked = 0 WHERE uid = 'a'")
+	if err := db.TableUpgrade(&unique); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Insert("users", *(&Record{}).AddStr("uid", []byte("c")).AddStr("pass", nil).
+		AddStr("role", nil).AddInt64("locked", 1)); !errors.Is(err, ErrUnique) {
+		t.Errorf("expect the new unique to apply: %v", err)
+	}
+
+	bad := &TableDef{Name: "users", Types: []uint32{TYPE_INT64}, Cols: []string{"uid"}, PKeys: 1}
+	if err := db.TableUpgrade(bad); err == nil {
+		t.Errorf("expect an error for changed columns")
+	}
+	fewer := *more
+	fewer.Indexes = [][]string{{"role"}}
+	if err := db.TableUpgrade(&fewer); err == nil {
+		t.Errorf("expect an error for a dropped index")
+	}
+}
@@ -4,27 +4,84 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"slices"
 	. "types"
 	. "utils"
 )
 
+const (
+	INDEX_ADD = 1
+	INDEX_DEL = 2
+)
+
 // add a row to the table
-func dbUpdate(db *DB, tdef *TableDef, rec Record, mode int) (bool, error) {
+func dbUpdate(tx *DBTX, tdef *TableDef, rec Record, mode int) (bool, error) {
 	values, err := checkRecord(tdef, rec, len(tdef.Cols))
 	if err != nil {
 		return false, err
 	}
+	row := Record{Cols: tdef.Cols, Vals: values}
+	if err := checkRefs(tx, tdef, row); err != nil {
+		return false, err
+	}
+	if err := checkUniques(tx, tdef, row); err != nil {
+		return false, err
+	}
 	key := encodeKey(nil, tdef.Prefix, values[:tdef.PKeys])
 	val := encodeValues(nil, values[tdef.PKeys:])
-	return db.kv.Update(key, val, mode)
+	req := InsertReq{Key: key, Val: val, Mode: mode}
+	tx.kv.Update(&req)
+	switch {
+	case !req.Updated && mode == MODE_INSERT_ONLY:
+		return false, fmt.Errorf("%w: %s", ErrKeyExist, tdef.Name)
+	case !req.Updated && mode == MODE_UPDATE_ONLY:
+		return false, fmt.Errorf("%w: %s", ErrKeyNotExist, tdef.Name)
+	}
+	var old *Record
+	if !req.Added {
+		oldValues := make([]Value, len(tdef.Cols))
+		copy(oldValues, values[:tdef.PKeys])
+		for i := tdef.PKeys; i < len(tdef.Cols); i++ {
+			oldValues[i].Type = tdef.Types[i]
+		}
+		decodeValues(req.Old, oldValues[tdef.PKeys:])
+		old = &Record{Cols: tdef.Cols, Vals: oldValues}
+	}
+	// maintain indexes
+	if old != nil {
+		indexOp(tx, tdef, *old, INDEX_DEL)
+	}
+	indexOp(tx, tdef, row, INDEX_ADD)
+	tx.capture(tdef, old, &row)
+	return true, nil
 }
 
-func (db *DB) Set(table string, rec Record, mode int) (bool, error) {
-	tdef := getTableDef(db, table)
-	if tdef == nil {
-		return false, fmt.Errorf("table not found: %s", table)
+// add or remove the secondary index keys of a row
+func indexOp(tx *DBTX, tdef *TableDef, rec Record, op int) {
+	for i, index := range tdef.Indexes {
+		ivals := make([]Value, len(index))
+		for j, c := range index {
+			ivals[j] = *rec.Get(c)
+		}
+		key := encodeKey(nil, tdef.IndexPrefixes[i], ivals)
+		switch op {
+		case INDEX_ADD:
+			tx.kv.Update(&InsertReq{Key: key, Mode: MODE_UPSERT})
+		case INDEX_DEL:
+			tx.kv.Del(&DeleteReq{Key: key})
+		default:
+			panic("what?")
+		}
 	}
-	return dbUpdate(db, tdef, rec, mode)
+}
+
+func (db *DB) Set(table string, rec Record, mode int) (bool, error) {
+	ok := false
+	err := db.update(func(tx *DBTX) (err error) {
+		ok, err = tx.Set(table, rec, mode)
+		return err
+	})
+	return ok, err
 }
 func (db *DB) Insert(table string, rec Record) (bool, error) {
 	return db.Set(table, rec, MODE_INSERT_ONLY)
@@ -35,55 +92,188 @@ func (db *DB) Update(table string, rec Record) (bool, error) {
 func (db *DB) Upsert(table string, rec Record) (bool, error) {
 	return db.Set(table, rec, MODE_UPSERT)
 }
-func dbDelete(db *DB, tdef *TableDef, rec Record) (bool, error) {
+func dbDelete(tx *DBTX, tdef *TableDef, rec Record) (bool, error) {
 	values, err := checkRecord(tdef, rec, tdef.PKeys)
 	if err != nil {
 		return false, err
 	}
 	key := encodeKey(nil, tdef.Prefix, values[:tdef.PKeys])
-	return db.kv.Del(key)
+	req := DeleteReq{Key: key}
+	if !tx.kv.Del(&req) {
+		return false, nil
+	}
+	for i := tdef.PKeys; i < len(tdef.Cols); i++ {
+		values[i].Type = tdef.Types[i]
+	}
+	decodeValues(req.Old, values[tdef.PKeys:])
+	row := Record{Cols: tdef.Cols, Vals: values}
+	// maintain indexes
+	indexOp(tx, tdef, row, INDEX_DEL)
+	tx.capture(tdef, &row, nil)
+	// the rows referencing this one
+	return true, deleteRefs(tx, tdef, row)
 }
 func (db *DB) Delete(table string, rec Record) (bool, error) {
-	tdef := getTableDef(db, table)
-	if tdef == nil {
-		return false, fmt.Errorf("table not found: %s", table)
-	}
-	return dbDelete(db, tdef, rec)
+	ok := false
+	err := db.update(func(tx *DBTX) (err error) {
+		ok, err = tx.Delete(table, rec)
+		return err
+	})
+	return ok, err
 }
 
 func (db *DB) TableNew(tdef *TableDef) error {
-	// if err := tableDefCheck(tdef); err != nil {
-	// 	return err
-	// }
+	return db.update(func(tx *DBTX) error {
+		return tx.TableNew(tdef)
+	})
+}
+func dbTableNew(tx *DBTX, tdef *TableDef) error {
+	if err := tableDefCheck(tdef); err != nil {
+		return err
+	}
 	// check the existing table
 	table := (&Record{}).AddStr("name", []byte(tdef.Name))
-	ok, err := dbGet(db, TDEF_TABLE, table)
+	ok, err := dbGet(tx, TDEF_TABLE, table)
 	Assert(err == nil)
 	if ok {
 		return fmt.Errorf("table exists: %s", tdef.Name)
 	}
-	// allocate a new prefix
-	// Assert(tdef.Prefix == 0)
-	tdef.Prefix = TABLE_PREFIX_MIN
-	meta := (&Record{}).AddStr("key", []byte("next_prefix"))
-	ok, err = dbGet(db, TDEF_META, meta)
-	Assert(err == nil)
-	if ok {
-		tdef.Prefix = binary.BigEndian.Uint32(meta.Get("val").Str)
-		Assert(tdef.Prefix > TABLE_PREFIX_MIN)
-	} else {
-		meta.AddStr("val", make([]byte, 4))
+	if err := checkTableRefs(tx, tdef); err != nil {
+		return err
 	}
-	// update the next prefix
-	binary.BigEndian.PutUint32(meta.Get("val").Str, tdef.Prefix+1)
-	_, err = dbUpdate(db, TDEF_META, *meta, 0)
+	// allocate new prefixes for the table and its indexes
+	tdef.Prefix, err = allocPrefixes(tx, 1+uint32(len(tdef.Indexes)))
 	if err != nil {
 		return err
 	}
+	tdef.IndexPrefixes = nil
+	for i := range tdef.Indexes {
+		tdef.IndexPrefixes = append(tdef.IndexPrefixes, tdef.Prefix+1+uint32(i))
+	}
 	// store the definition
 	val, err := json.Marshal(tdef)
 	Assert(err == nil)
 	table.AddStr("def", val)
-	_, err = dbUpdate(db, TDEF_TABLE, *table, 0)
+	_, err = dbUpdate(tx, TDEF_TABLE, *table, 0)
 	return err
 }
+
+// allocate n consecutive B-tree key prefixes, returns the first one
+func allocPrefixes(tx *DBTX, n uint32) (uint32, error) {
+	prefix := uint32(TABLE_PREFIX_MIN)
+	meta := (&Record{}).AddStr("key", []byte("next_prefix"))
+	ok, err := dbGet(tx, TDEF_META, meta)
+	Assert(err == nil)
+	if ok {
+		prefix = binary.BigEndian.Uint32(meta.Get("val").Str)
+		Assert(prefix > TABLE_PREFIX_MIN)
+	} else {
+		meta.AddStr("val", make([]byte, 4))
+	}
+	binary.BigEndian.PutUint32(meta.Get("val").Str, prefix+n)
+	_, err = dbUpdate(tx, TDEF_META, *meta, 0)
+	return prefix, err
+}
+
+// the old list is the start of the new one
+func extends[T any](old []T, new []T, eq func(T, T) bool) bool {
+	return len(old) <= len(new) && slices.EqualFunc(old, new[:len(old)], eq)
+}
+func sameRef(a TableRef, b TableRef) bool {
+	return a.Table == b.Table && a.Cascade == b.Cascade && slices.Equal(a.Cols, b.Cols)
+}
+
+// Upgrade the existing table of the same name to tdef. The columns,
+// indexes, uniques and refs of tdef must extend the existing ones:
+// the existing rows get zero values in the new columns and entries in
+// the new indexes, and must hold the new constraints.
+func dbTableUpgrade(tx *DBTX, tdef *TableDef) error {
+	old := getTableDef(tx, tdef.Name)
+	if old == nil {
+		return fmt.Errorf("table not found: %s", tdef.Name)
+	}
+	n := len(old.Cols)
+	if len(tdef.Cols) < n || len(tdef.Types) != len(tdef.Cols) || tdef.PKeys != old.PKeys ||
+		!slices.Equal(tdef.Cols[:n], old.Cols) || !slices.Equal(tdef.Types[:n], old.Types) {
+		return fmt.Errorf("bad columns to add: %s", tdef.Name)
+	}
+	def := *tdef
+	def.Cols = slices.Clone(tdef.Cols)
+	def.Types = slices.Clone(tdef.Types)
+	def.Indexes = slices.Clone(tdef.Indexes)
+	if err := tableDefCheck(&def); err != nil {
+		return err
+	}
+	if !extends(old.Indexes, def.Indexes, slices.Equal[[]string]) ||
+		!extends(old.Uniques, def.Uniques, slices.Equal[[]string]) || !extends(old.Refs, def.Refs, sameRef) {
+		return fmt.Errorf("bad constraints to add: %s", tdef.Name)
+	}
+	nindex := len(old.Indexes)
+	if len(def.Cols) == n && len(def.Indexes) == nindex &&
+		len(def.Uniques) == len(old.Uniques) && len(def.Refs) == len(old.Refs) {
+		return nil // unchanged
+	}
+	if err := checkTableRefs(tx, &def); err != nil {
+		return err
+	}
+	def.Prefix = old.Prefix
+	def.IndexPrefixes = slices.Clone(old.IndexPrefixes)
+	if len(def.Indexes) > nindex {
+		prefix, err := allocPrefixes(tx, uint32(len(def.Indexes)-nindex))
+		if err != nil {
+			return err
+		}
+		for i := nindex; i < len(def.Indexes); i++ {
+			def.IndexPrefixes = append(def.IndexPrefixes, prefix+uint32(i-nindex))
+		}
+	}
+	// collect the rows before modifying the tree
+	sc := Scanner{Cmp1: CMP_GE, Cmp2: CMP_LE}
+	if err := dbScan(tx, old, &sc); err != nil {
+		return err
+	}
+	rows := []Record{}
+	for ; sc.Valid(); sc.Next() {
+		rec := Record{}
+		sc.Deref(&rec)
+		for i := n; i < len(def.Cols); i++ {
+			rec.Vals = append(rec.Vals, Value{Type: def.Types[i]})
+		}
+		rec.Cols = def.Cols
+		rows = append(rows, rec)
+	}
+	// the keys and the existing indexes are unchanged
+	added := TableDef{Indexes: def.Indexes[nindex:], IndexPrefixes: def.IndexPrefixes[nindex:]}
+	for _, rec := range rows {
+		if len(def.Cols) > n {
+			key := encodeKey(nil, def.Prefix, rec.Vals[:def.PKeys])
+			tx.kv.Update(&InsertReq{Key: key, Val: encodeValues(nil, rec.Vals[def.PKeys:]), Mode: MODE_UPDATE_ONLY})
+		}
+		indexOp(tx, &added, rec, INDEX_ADD)
+	}
+	// the new constraints hold on the existing rows
+	check := def
+	check.Uniques = def.Uniques[len(old.Uniques):]
+	check.Refs = def.Refs[len(old.Refs):]
+	for _, rec := range rows {
+		if err := checkRefs(tx, &check, rec); err != nil {
+			return err
+		}
+		if err := checkUniques(tx, &check, rec); err != nil {
+			return err
+		}
+	}
+	val, err := json.Marshal(&def)
+	Assert(err == nil)
+	table := (&Record{}).AddStr("name", []byte(def.Name)).AddStr("def", val)
+	if _, err := dbUpdate(tx, TDEF_TABLE, *table, MODE_UPDATE_ONLY); err != nil {
+		return err
+	}
+	delete(tx.db.tables, def.Name)
+	return nil
+}
+func (db *DB) TableUpgrade(tdef *TableDef) error {
+	return db.update(func(tx *DBTX) error {
+		return dbTableUpgrade(tx, tdef)
+	})
+}
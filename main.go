@@ -1,22 +1,27 @@
-//go:generate go run github.com/dmarkham/enumer -json -text -output=types/json.go -type=Operation,Code types/
+//go:generate go run github.com/dmarkham/enumer -json -text -output=types/json.go -type=Operation,Code,ErrCode types/
 
 package main
 
 import (
-	_ "network"  // force initialization of network by empty import
-	
+	_ "network" // force initialization of network by empty import
+
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"os"
-	
+	"strings"
+
 	"client"
+	"db"
+	"server"
 	. "types"
 )
 
 var fileFlag string
-var iFlag bool 
+var iFlag bool
 
 func init() {
 	flag.StringVar(&fileFlag, "f", "", "Provide a valid file name or path to file to execute the program by reading input from file.")
@@ -34,13 +39,13 @@ func create_files(input_path string, output_path string) (*os.File, *os.File) {
 	if err != nil {
 		fmt.Println("Error creating file:", err)
 	}
-	
+
 	return input, output
 }
 
 func process(input *os.File, output *os.File) {
 	if input == nil || output == nil {
-		return 
+		return
 	}
 	defer input.Close()
 	defer output.Close()
@@ -50,19 +55,33 @@ func process(input *os.File, output *os.File) {
 
 	var err error
 	for {
-		var request Request
-
 		if input == os.Stdin {
 			fmt.Print(">> ")
 		}
 
-		err = dec.Decode(&request)
+		// a request, or an array of requests for a batch
+		var raw json.RawMessage
+		err = dec.Decode(&raw)
 		if err == io.EOF {
 			break
 		} else if err != nil {
 			fmt.Println("Error reading from file:", err)
 			return
 		}
+		// the numbers of the values are kept exact
+		var request Request
+		rd := json.NewDecoder(bytes.NewReader(raw))
+		rd.UseNumber()
+		if raw[0] == '[' {
+			request.Op = BATCH
+			err = rd.Decode(&request.Batch)
+		} else {
+			err = rd.Decode(&request)
+		}
+		if err != nil {
+			fmt.Println("Error reading from file:", err)
+			return
+		}
 
 		output.WriteString("Input: ")
 		err = enc.Encode(request)
@@ -82,13 +101,71 @@ func process(input *os.File, output *os.File) {
 	}
 }
 
+// Input: the function running a statement. Reads one statement per
+// line from the input and prints the result of each statement.
+//
+//	sql> SELECT key,value FROM key_value WHERE key >= 'a' AND key < 'b' LIMIT 10
+func repl(exec func(string) (*db.QLResult, error), input io.Reader, output io.Writer) {
+	scanner := bufio.NewScanner(input)
+	for {
+		if input == os.Stdin {
+			fmt.Fprint(output, "sql> ")
+		}
+		if !scanner.Scan() {
+			break
+		}
+		query := strings.TrimSpace(scanner.Text())
+		if query == "" {
+			continue
+		}
+		res, err := exec(query)
+		if err != nil {
+			fmt.Fprintln(output, "Error:", err)
+			continue
+		}
+		if res.Cols == nil {
+			fmt.Fprintf(output, "%d row(s) affected\n", res.Affected)
+			continue
+		}
+		fmt.Fprintln(output, strings.Join(res.Cols, "\t"))
+		for _, rec := range res.Rows {
+			cells := []string{}
+			for _, v := range rec.Vals {
+				if v.Type == db.TYPE_INT64 {
+					cells = append(cells, fmt.Sprint(v.I64))
+				} else {
+					cells = append(cells, string(v.Str))
+				}
+			}
+			fmt.Fprintln(output, strings.Join(cells, "\t"))
+		}
+		fmt.Fprintf(output, "(%d rows)\n", len(res.Rows))
+	}
+}
+
 func main() {
 	defer close(client.Requests)
 
 	flag.Parse()
 
+	// subcommand: an SQL console over the server's tables
+	if flag.Arg(0) == "sql" {
+		repl(server.Exec, os.Stdin, os.Stdout)
+		return
+	}
+	// subcommand: check the chain of the audit log
+	if flag.Arg(0) == "verify-audit" {
+		n, err := server.VerifyAudit()
+		if err != nil {
+			fmt.Printf("audit log: %d entries verified, %v\n", n, err)
+			os.Exit(1)
+		}
+		fmt.Printf("audit log: %d entries verified\n", n)
+		return
+	}
+
 	if (iFlag && fileFlag != "") || (!iFlag && fileFlag == "") {
-		fmt.Println("Error in running program. Please provide either only -i flag or -f <path/to/file_name flag.")
+		fmt.Println("Error in running program. Please provide either only -i flag or -f <path/to/file_name flag, or the sql or verify-audit subcommand.")
 		return
 	}
 
@@ -6,6 +6,9 @@ import (
 )
 
 func init() {
+	if err := server.Start(); err != nil {
+		panic(err)
+	}
 	client.ObtainServerPublicKey()
 
 	go relay()
@@ -2,6 +2,8 @@ package server
 
 import (
 	"fmt"
+	"slices"
+	"strings"
 	. "types"
 )
 
@@ -22,6 +24,12 @@ var KeyGetter = map[string]get{
 	"copyfroms": func(k Key) []string { return k.Copyfroms },
 	"copytos":   func(k Key) []string { return k.Copytos },
 	"indirects": func(k Key) []string { return k.Indirects },
+	"coowners":  func(k Key) []string { return k.Coowners },
+
+	"deny_readers":   func(k Key) []string { return k.Deny_readers },
+	"deny_writers":   func(k Key) []string { return k.Deny_writers },
+	"deny_copyfroms": func(k Key) []string { return k.Deny_copyfroms },
+	"deny_copytos":   func(k Key) []string { return k.Deny_copytos },
 }
 var KeySetter = map[string]set{
 	"readers":   func(k *Key, v []string) { k.Readers = v },
@@ -29,21 +37,34 @@ var KeySetter = map[string]set{
 	"copyfroms": func(k *Key, v []string) { k.Copyfroms = v },
 	"copytos":   func(k *Key, v []string) { k.Copytos = v },
 	"indirects": func(k *Key, v []string) { k.Indirects = v },
+	"coowners":  func(k *Key, v []string) { k.Coowners = v },
+
+	"deny_readers":   func(k *Key, v []string) { k.Deny_readers = v },
+	"deny_writers":   func(k *Key, v []string) { k.Deny_writers = v },
+	"deny_copyfroms": func(k *Key, v []string) { k.Deny_copyfroms = v },
+	"deny_copytos":   func(k *Key, v []string) { k.Deny_copytos = v },
 }
 
+// the owner or a co-owner of the key
+func canManage(k Key, uid string) bool {
+	return k.Owner == uid || slices.Contains(expandPrincipals(k.Coowners), uid)
+}
 func isOwner(uid string, key string) bool {
 	k, ok := Keys[key]
-	if !ok || k.Owner != uid {
+	if !ok || !(canManage(k, uid) || isAdmin(uid)) {
 		return false
 	}
 	return true
 }
 func DeleteKey(uid string, key string) bool {
 	k, ok := Keys[key]
-	if !ok || k.Owner != uid {
+	if !ok || !(canManage(k, uid) || isAdmin(uid)) {
 		return false
 	}
-	delete(Keys, key)
+	if dropACL(key) != nil {
+		return false
+	}
+	removeKey(key)
 	return true
 }
 
@@ -58,34 +79,118 @@ func Create(uid string, key string, metadata map[string][]string) bool {
 			metadata[k] = []string{}
 		}
 	}
-	Keys[key] = Key{
+	k := Key{
 		Readers:   metadata["readers"],
 		Writers:   metadata["writers"],
 		Copyfroms: metadata["copyfroms"],
 		Copytos:   metadata["copytos"],
 		Indirects: metadata["indirects"],
+		Coowners:  metadata["coowners"],
 		Owner:     uid,
+
+		Deny_readers:   metadata["deny_readers"],
+		Deny_writers:   metadata["deny_writers"],
+		Deny_copyfroms: metadata["deny_copyfroms"],
+		Deny_copytos:   metadata["deny_copytos"],
+	}
+	if storeACL(key, k) != nil {
+		return false
 	}
+	putKey(key, k)
 	return true
 }
 func Modacl(uid string, key string, metadata map[string][]string) bool {
+	return EditAcl(uid, key, AclEdit{Set: metadata}) == ERR_NONE
+}
+
+// The lists in Set are replaced, then the principals in Add and Remove
+// are added to or removed from their lists. With Version set, the edit
+// is rejected if the acl has changed since that version.
+type AclEdit struct {
+	Set     map[string][]string
+	Add     map[string][]string
+	Remove  map[string][]string
+	Version *uint64
+
+	Conditions map[string]map[string]Condition // replaces the conditions of a list
+}
 
+func EditAcl(uid string, key string, edit AclEdit) ErrCode {
 	old, ok := Keys[key]
-	if !ok || old.Owner != uid {
-		return false
+	admin := isAdmin(uid)
+	if !ok || !(canManage(old, uid) || admin) {
+		return ERR_DENIED
+	}
+	// only the owner changes the co-owners
+	if old.Owner != uid && !admin && (edit.Set["coowners"] != nil || edit.Add["coowners"] != nil || edit.Remove["coowners"] != nil) {
+		return ERR_DENIED
 	}
-	for attr, v := range metadata {
+	if edit.Version != nil && *edit.Version != old.Version {
+		return ERR_CONFLICT
+	}
+	if len(edit.Conditions) > 0 {
+		conds := make(map[string]map[string]Condition)
+		for attr, m := range old.Conditions {
+			conds[attr] = m
+		}
+		for attr, m := range edit.Conditions {
+			if _, ok := KeyGetter[attr]; !ok {
+				return ERR_BAD_REQUEST
+			}
+			for _, c := range m {
+				if !validCondition(c) {
+					return ERR_BAD_REQUEST
+				}
+			}
+			conds[attr] = m
+			if len(m) == 0 {
+				delete(conds, attr)
+			}
+		}
+		old.Conditions = conds
+	}
+	for attr, v := range edit.Set {
 		setter, ok := KeySetter[attr]
 		if v != nil && ok {
 			setter(&old, v)
 		}
 	}
-	Keys[key] = old
-	return true
+	for attr, v := range edit.Add {
+		setter, ok := KeySetter[attr]
+		if !ok {
+			continue
+		}
+		list := slices.Clone(KeyGetter[attr](old))
+		for _, p := range v {
+			if !slices.Contains(list, p) {
+				list = append(list, p)
+			}
+		}
+		setter(&old, list)
+	}
+	for attr, v := range edit.Remove {
+		setter, ok := KeySetter[attr]
+		if !ok {
+			continue
+		}
+		list := slices.DeleteFunc(slices.Clone(KeyGetter[attr](old)), func(p string) bool {
+			return slices.Contains(v, p)
+		})
+		if list == nil {
+			list = []string{}
+		}
+		setter(&old, list)
+	}
+	old.Version++
+	if storeACL(key, old) != nil {
+		return ERR_FAILED
+	}
+	putKey(key, old)
+	return ERR_NONE
 }
 func Revacl(uid string, key string) map[string][]string {
 	old, ok := Keys[key]
-	if !ok || old.Owner != uid {
+	if !ok || !(canManage(old, uid) || isAdmin(uid) || isAuditor(uid)) {
 		return nil
 	}
 	result := make(map[string][]string)
@@ -94,6 +199,11 @@ func Revacl(uid string, key string) map[string][]string {
 	result["copyfroms"] = old.Copyfroms
 	result["copytos"] = old.Copytos
 	result["indirects"] = old.Indirects
+	result["owner"] = []string{old.Owner}
+	result["coowners"] = old.Coowners
+	for _, attr := range []string{"deny_readers", "deny_writers", "deny_copyfroms", "deny_copytos"} {
+		result[attr] = KeyGetter[attr](old)
+	}
 	result["R"] = R(key)
 	result["W"] = W(key)
 	result["Csrc"] = Csrc(key)
@@ -101,20 +211,108 @@ func Revacl(uid string, key string) map[string][]string {
 	return result
 }
 
+// Input: the owner uid, key and the new owner. Transfers the
+// ownership, or records it until the new owner accepts if accept
+// is set. Giving the key to the owner cancels a pending transfer.
+func Chown(uid string, key string, newOwner string, accept bool) bool {
+	k, ok := Keys[key]
+	if !ok || k.Owner != uid || newOwner == "" || strings.HasPrefix(newOwner, GROUP_PREFIX) {
+		return false
+	}
+	switch {
+	case newOwner == uid:
+		k.Pending = ""
+	case accept:
+		k.Pending = newOwner
+	default:
+		transferKey(&k, newOwner)
+	}
+	k.Version++
+	if storeACL(key, k) != nil {
+		return false
+	}
+	putKey(key, k)
+	return true
+}
+
+// Input: uid and key. The pending new owner takes the key.
+func AcceptChown(uid string, key string) bool {
+	k, ok := Keys[key]
+	if !ok || uid == "" || k.Pending != uid {
+		return false
+	}
+	transferKey(&k, uid)
+	k.Version++
+	if storeACL(key, k) != nil {
+		return false
+	}
+	putKey(key, k)
+	return true
+}
+func transferKey(k *Key, newOwner string) {
+	k.Owner = newOwner
+	k.Pending = ""
+	k.Coowners = slices.DeleteFunc(slices.Clone(k.Coowners), func(c string) bool { return c == newOwner })
+}
+
+// Input: the owner uid, key, the new name and whether to rewrite the
+// indirects of the other keys of uid. Moves the ACL of key to the new
+// name in the store. Returns the changed ACLs, to put in Keys once the
+// transaction commits.
+func Rename(uid string, key string, newKey string, rewrite bool) (map[string]Key, bool) {
+	k, ok := Keys[key]
+	if !ok || k.Owner != uid {
+		return nil, false
+	}
+	if _, ok := Keys[newKey]; ok {
+		return nil, false
+	}
+	if dropACL(key) != nil || storeACL(newKey, k) != nil {
+		return nil, false
+	}
+	changed := map[string]Key{newKey: k}
+	if !rewrite {
+		return changed, true
+	}
+	for name, other := range Keys {
+		if other.Owner != uid || !slices.Contains(other.Indirects, key) {
+			continue
+		}
+		if name == key {
+			name = newKey
+		}
+		other.Indirects = slices.Clone(other.Indirects)
+		for i, next := range other.Indirects {
+			if next == key {
+				other.Indirects[i] = newKey
+			}
+		}
+		other.Version++
+		if storeACL(name, other) != nil {
+			return nil, false
+		}
+		changed[name] = other
+	}
+	return changed, true
+}
+
 func R(key string) []string {
-	return bfs(key, "readers")
+	return cachedBfs(key, "readers")
 }
 func W(key string) []string {
-	return bfs(key, "writers")
+	return cachedBfs(key, "writers")
 
 }
 func Csrc(key string) []string {
-	return bfs(key, "copyfroms")
+	return cachedBfs(key, "copyfroms")
 }
 func Cdst(key string) []string {
-	return bfs(key, "copytos")
+	return cachedBfs(key, "copytos")
 }
 
+// The principals granted attr on key through its indirects. Only the
+// deny list of key itself applies: it is expanded like the grants and
+// removes the principals whatever key granted them.
 func bfs(key string, attr string) []string {
 	visited := make(map[string]bool)
 	principal := make(map[string]bool)
@@ -141,5 +339,9 @@ func bfs(key string, attr string) []string {
 	for p := range principal {
 		result = append(result, p)
 	}
-	return result
+	denied := make(map[string]bool)
+	for _, p := range expandPrincipals(KeyGetter["deny_"+attr](Keys[key])) {
+		denied[p] = true
+	}
+	return slices.DeleteFunc(expandPrincipals(result), func(p string) bool { return denied[p] })
 }
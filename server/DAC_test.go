@@ -7,10 +7,10 @@ import (
 )
 
 func TestCreate(t *testing.T) {
-	Keys = make(map[string]Key)
+	resetKeys(nil)
 	var metadata = map[string][]string{
 		"readers": []string{"fbs"}}
-	ok := Create("fbs", "gs", metadata)
+	ok := createKey("fbs", "gs", metadata)
 	if !ok {
 
 		t.Errorf("fail")
@@ -18,10 +18,10 @@ func TestCreate(t *testing.T) {
 }
 
 func TestRevacl(t *testing.T) {
-	Keys = make(map[string]Key)
+	resetKeys(nil)
 	var metadata = map[string][]string{
 		"readers": []string{"fbs"}}
-	Create("fbs", "gs", metadata)
+	createKey("fbs", "gs", metadata)
 	wrong_uid := Revacl("fbss", "gs")
 	wrong_key := Revacl("fbs", "gss")
 	if wrong_key != nil || wrong_uid != nil {
@@ -55,7 +55,7 @@ func compare(a []string, b []string) bool {
 	}
 }
 func TestModacl(t *testing.T) {
-	Keys = make(map[string]Key)
+	resetKeys(nil)
 	var metadata = map[string][]string{
 		"readers":   []string{"fbs", "gs", "kz", "a", "b"},
 		"writers":   []string{"a", "b"},
@@ -63,7 +63,7 @@ func TestModacl(t *testing.T) {
 		"copytos":   []string{"a", "b"},
 		"indirects": []string{"B"},
 	}
-	Create("fbs", "A", metadata)
+	createKey("fbs", "A", metadata)
 
 	metadata = map[string][]string{
 		"readers":   []string{"fbs", "gs", "kz"},
@@ -72,7 +72,7 @@ func TestModacl(t *testing.T) {
 		"copytos":   []string{"fbs", "gs", "kz"},
 		"indirects": []string{"A"},
 	}
-	Create("std1", "B", metadata)
+	createKey("std1", "B", metadata)
 
 	correct := Revacl("fbs", "A")
 	if correct["readers"][0] != "fbs" {
@@ -103,7 +103,7 @@ func TestModacl(t *testing.T) {
 	}
 }
 func TestDelete(t *testing.T) {
-	Keys = make(map[string]Key)
+	resetKeys(nil)
 	var metadata = map[string][]string{
 		"readers":   []string{"fbs", "gs", "kz", "a", "b"},
 		"writers":   []string{"a", "b"},
@@ -111,7 +111,7 @@ func TestDelete(t *testing.T) {
 		"copytos":   []string{"a", "b"},
 		"indirects": []string{"B"},
 	}
-	Create("fbs", "A", metadata)
+	createKey("fbs", "A", metadata)
 
 	result := DeleteKey("fbb", "A")
 
@@ -127,3 +127,31 @@ func TestDelete(t *testing.T) {
 	}
 
 }
+
+func TestDeny(t *testing.T) {
+	resetKeys(nil)
+	Groups = make(map[string]Group)
+	CreateGroup("fbs", "interns")
+	UpdateGroup("fbs", "interns", []string{"ij", "kl"}, nil)
+	createKey("gs", "base", map[string][]string{"readers": {"ab", "ij", "kl"}, "writers": {"ab"}})
+	createKey("fbs", "top", map[string][]string{
+		"readers":      {"gh"},
+		"indirects":    {"base"},
+		"deny_readers": {"group:interns", "gh"},
+	})
+	// the deny beats both the inherited and the direct grants
+	if !compare(R("top"), []string{"ab"}) || !compare(W("top"), []string{"ab"}) {
+		t.Errorf("bad rights: %v %v", R("top"), W("top"))
+	}
+	// a deny is not inherited
+	if !compare(R("base"), []string{"ab", "ij", "kl"}) {
+		t.Errorf("bad rights: %v", R("base"))
+	}
+	Modacl("fbs", "top", map[string][]string{"deny_readers": {}, "deny_writers": {"ab"}})
+	if !compare(R("top"), []string{"ab", "gh", "ij", "kl"}) || len(W("top")) != 0 {
+		t.Errorf("bad rights after modacl: %v %v", R("top"), W("top"))
+	}
+	if !compare(Revacl("fbs", "top")["deny_writers"], []string{"ab"}) {
+		t.Errorf("expect the deny list in revacl")
+	}
+}
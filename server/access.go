@@ -0,0 +1,76 @@
+package server
+
+import (
+	"slices"
+	"sort"
+	. "types"
+)
+
+// Input: the caller uid and the user to look up. Returns the rights
+// of the user over the keys the caller owns or co-owns, or over all
+// keys for an admin or an auditor, with the indirects path deriving each of them.
+func AccessOf(uid string, user string) []Access {
+	admin := isAdmin(uid) || isAuditor(uid)
+	names := make([]string, 0, len(Keys))
+	for key, k := range Keys {
+		if admin || canManage(k, uid) {
+			names = append(names, key)
+		}
+	}
+	sort.Strings(names)
+	result := []Access{}
+	for _, key := range names {
+		for _, attr := range []string{"readers", "writers", "copyfroms", "copytos"} {
+			if !slices.Contains(cachedBfs(key, attr), user) {
+				continue
+			}
+			if path, via := derivation(key, attr, user); path != nil {
+				result = append(result, Access{Key: key, Right: attr, Path: path, Via: via})
+			}
+		}
+	}
+	return result
+}
+
+// the shortest indirects path from key to a key granting attr to
+// user, and the entry granting it
+func derivation(key string, attr string, user string) ([]string, string) {
+	parent := map[string]string{key: ""}
+	queue := []string{key}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		k, ok := Keys[cur]
+		if !ok {
+			continue
+		}
+		for _, p := range KeyGetter[attr](k) {
+			if !slices.Contains(expandPrincipals([]string{p}), user) {
+				continue
+			}
+			path := []string{}
+			for at := cur; at != ""; at = parent[at] {
+				path = append([]string{at}, path...)
+			}
+			return path, p
+		}
+		for _, next := range k.Indirects {
+			if _, seen := parent[next]; !seen {
+				parent[next] = cur
+				queue = append(queue, next)
+			}
+		}
+	}
+	return nil, ""
+}
+
+// Input: the user to look up, the caller when empty. Returns a response
+// with the keys the user can access among the ones the caller may audit.
+func doAccess(request *Request, response *Response) {
+	user := request.Subject
+	if user == "" {
+		user = request.Uid
+	}
+	response.Access = AccessOf(request.Uid, user)
+	response.Status = OK
+}
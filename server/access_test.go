@@ -0,0 +1,34 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAccessOf(t *testing.T) {
+	resetKeys(nil)
+	createKey("fbs", "a1", map[string][]string{"readers": {"ab"}, "indirects": {"a2"}})
+	createKey("fbs", "a2", map[string][]string{"writers": {"group:auditors"}, "indirects": {"a3"}})
+	createKey("gs", "a3", map[string][]string{"readers": {"cd"}, "copytos": {"cd"}})
+	createKey("fbs", "a4", map[string][]string{"readers": {"cd"}, "deny_readers": {"cd"}})
+	CreateGroup("gs", "auditors")
+	UpdateGroup("gs", "auditors", []string{"cd"}, nil)
+
+	got := fmt.Sprint(AccessOf("fbs", "cd"))
+	want := "[{a1 readers [a1 a2 a3] cd} {a1 writers [a1 a2] group:auditors} {a1 copytos [a1 a2 a3] cd} " +
+		"{a2 readers [a2 a3] cd} {a2 writers [a2] group:auditors} {a2 copytos [a2 a3] cd}]"
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	// only the keys of the caller
+	if got := fmt.Sprint(AccessOf("gs", "cd")); got != "[{a3 readers [a3] cd} {a3 copytos [a3] cd}]" {
+		t.Errorf("got %s", got)
+	}
+	if got := AccessOf("ab", "cd"); len(got) != 0 {
+		t.Errorf("expect nothing for a non-owner, got %v", got)
+	}
+	addUser("aud", ROLE_AUDITOR)
+	if got := AccessOf("aud", "cd"); len(got) != 8 {
+		t.Errorf("expect all keys for an auditor, got %v", got)
+	}
+}
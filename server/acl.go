@@ -0,0 +1,101 @@
+package server
+
+import (
+	"encoding/json"
+
+	. "db"
+	. "types"
+)
+
+// the ACL of each key, meta is the JSON of types.Key
+var acl = &TableDef{
+	Name:    "acl",
+	Types:   []uint32{TYPE_BYTES, TYPE_BYTES, TYPE_BYTES},
+	Cols:    []string{"key", "owner", "meta"},
+	PKeys:   1,
+	Prefix:  0,
+	Indexes: [][]string{{"owner"}},
+	Refs:    []TableRef{{Cols: []string{"key"}, Table: "key_value", Cascade: true}},
+}
+
+// the transaction of the request being served
+var curTx *DBTX
+
+// Run fn in the current transaction, or in a new one if there is none.
+// All the writes of a request are in the same transaction.
+func withTx(fn func(tx *DBTX) error) error {
+	if curTx != nil {
+		return fn(curTx)
+	}
+	tx := DBTX{}
+	db.Begin(&tx)
+	curTx = &tx
+	err := fn(&tx)
+	curTx = nil
+	if err != nil {
+		db.Abort(&tx)
+		return err
+	}
+	return db.Commit(&tx)
+}
+
+// read a row in the current transaction, a request sees its own writes
+func getRow(table string, rec *Record) (bool, error) {
+	if curTx != nil {
+		return curTx.Get(table, rec)
+	}
+	return db.Get(table, rec)
+}
+
+// write a row in the current transaction
+func updateRow(table string, rec Record) error {
+	return withTx(func(tx *DBTX) error {
+		_, err := tx.Update(table, rec)
+		return err
+	})
+}
+
+// write the ACL of a key
+func storeACL(key string, k Key) error {
+	meta, err := json.Marshal(k)
+	if err != nil {
+		return err
+	}
+	rec := (&Record{}).
+		AddStr("key", []byte(key)).
+		AddStr("owner", []byte(k.Owner)).
+		AddStr("meta", meta)
+	return withTx(func(tx *DBTX) error {
+		_, err := tx.Upsert("acl", *rec)
+		return err
+	})
+}
+
+// remove the ACL of a key
+func dropACL(key string) error {
+	rec := (&Record{}).AddStr("key", []byte(key))
+	return withTx(func(tx *DBTX) error {
+		_, err := tx.Delete("acl", *rec)
+		return err
+	})
+}
+
+// rebuild Keys from the acl table
+func loadACLs() error {
+	sc := Scanner{Cmp1: CMP_GE, Cmp2: CMP_LE}
+	if err := db.Scan("acl", &sc); err != nil {
+		return err
+	}
+	keys := make(map[string]Key)
+	for ; sc.Valid(); sc.Next() {
+		rec := Record{}
+		sc.Deref(&rec)
+		k := Key{}
+		if err := json.Unmarshal(rec.Get("meta").Str, &k); err != nil {
+			return err
+		}
+		keys[string(rec.Get("key").Str)] = k
+	}
+	resetKeys(keys)
+	return nil
+}
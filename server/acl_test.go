@@ -0,0 +1,76 @@
+package server
+
+import (
+	"errors"
+	"testing"
+
+	. "db"
+	. "types"
+)
+
+func TestACLPersist(t *testing.T) {
+	resetKeys(nil)
+	createKey("fbs", "acl1", map[string][]string{"readers": {"gs"}})
+	createKey("fbs", "acl2", map[string][]string{"writers": {"gs"}})
+	Modacl("fbs", "acl1", map[string][]string{"readers": {"gs", "ab"}, "indirects": {"acl2"}})
+	DeleteKey("fbs", "acl2")
+	// the ACL is gone with an aborted transaction
+	withTx(func(tx *DBTX) error {
+		createKey("fbs", "acl3", nil)
+		return errors.New("abort")
+	})
+	// an ACL needs the value of its key, and goes with it
+	if err := storeACL("acl4", Key{Owner: "fbs"}); !errors.Is(err, ErrForeignKey) {
+		t.Errorf("expect the ACL of a missing value to be rejected: %v", err)
+	}
+	createKey("fbs", "acl5", nil)
+	db.Delete("key_value", *(&Record{}).AddStr("key", []byte("acl5")))
+
+	Keys = nil
+	if err := loadACLs(); err != nil {
+		t.Fatal(err)
+	}
+	k, ok := Keys["acl1"]
+	if !ok || k.Owner != "fbs" || !compare(k.Readers, []string{"ab", "gs"}) || !compare(k.Indirects, []string{"acl2"}) {
+		t.Errorf("bad ACL: %+v", k)
+	}
+	if _, ok := Keys["acl2"]; ok {
+		t.Errorf("expect acl2 to be deleted")
+	}
+	if _, ok := Keys["acl5"]; ok {
+		t.Errorf("expect acl5 to be deleted with its value")
+	}
+	if _, ok := Keys["acl3"]; ok {
+		t.Errorf("expect acl3 to be rolled back")
+	}
+}
+
+func TestEditAcl(t *testing.T) {
+	resetKeys(nil)
+	createKey("fbs", "ek", map[string][]string{"readers": {"ab", "cd"}, "writers": {"ab"}})
+	code := EditAcl("fbs", "ek", AclEdit{
+		Add:    map[string][]string{"readers": {"ef", "ab"}, "indirects": {"ek2"}},
+		Remove: map[string][]string{"readers": {"cd"}, "writers": {"ab"}},
+	})
+	k := Keys["ek"]
+	if code != ERR_NONE || !compare(k.Readers, []string{"ab", "ef"}) || k.Writers == nil || len(k.Writers) != 0 ||
+		!compare(k.Indirects, []string{"ek2"}) || k.Version != 1 {
+		t.Errorf("bad edit: %v %+v", code, k)
+	}
+
+	// a stale version is rejected
+	stale := uint64(0)
+	if code := EditAcl("fbs", "ek", AclEdit{Add: map[string][]string{"readers": {"gh"}}, Version: &stale}); code != ERR_CONFLICT {
+		t.Errorf("expect a conflict, got %v", code)
+	}
+	current := uint64(1)
+	if code := EditAcl("fbs", "ek", AclEdit{Add: map[string][]string{"readers": {"gh"}}, Version: &current}); code != ERR_NONE {
+		t.Errorf("expect the edit to apply, got %v", code)
+	}
+	if EditAcl("ab", "ek", AclEdit{Add: map[string][]string{"readers": {"ab"}}}) != ERR_DENIED {
+		t.Errorf("expect a reader to be denied")
+	}
+	if k := Keys["ek"]; !compare(k.Readers, []string{"ab", "ef", "gh"}) || k.Version != 2 {
+		t.Errorf("bad acl: %+v", k)
+	}
+}
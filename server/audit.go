@@ -0,0 +1,162 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"crypto_utils"
+	. "db"
+	. "types"
+)
+
+// the hash-chained log of the operations, append only
+var audit = &TableDef{
+	Name:    "audit",
+	Types:   []uint32{TYPE_INT64, TYPE_BYTES, TYPE_BYTES, TYPE_BYTES, TYPE_BYTES},
+	Cols:    []string{"seq", "uid", "key", "key2", "entry"}, // entry: the JSON of types.AuditEntry
+	PKeys:   1,
+	Prefix:  0,
+	Indexes: [][]string{{"uid"}, {"key"}, {"key2"}},
+}
+
+// the last entry of the log
+var auditTail AuditEntry
+
+func auditHash(e AuditEntry) []byte {
+	e.Hash = nil
+	data, err := json.Marshal(e)
+	if err != nil {
+		panic(err)
+	}
+	return crypto_utils.Hash(data)
+}
+
+// Input: client name, request and response of an operation.
+// Appends an entry to the audit log.
+func auditOp(client string, request *Request, response *Response) error {
+	e := AuditEntry{
+		Seq:    auditTail.Seq + 1,
+		Time:   clock().UnixNano(),
+		Uid:    request.Uid,
+		Client: client,
+		Op:     request.Op,
+		Key:    request.Key,
+		Status: response.Status,
+		Prev:   auditTail.Hash,
+	}
+	switch request.Op {
+	case COPY:
+		e.Key, e.Key2 = request.Src_key, request.Dst_key
+	case RENAME:
+		e.Key2 = request.New_key
+	}
+	e.Hash = auditHash(e)
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	rec := (&Record{}).AddInt64("seq", e.Seq).AddStr("uid", []byte(e.Uid)).
+		AddStr("key", []byte(e.Key)).AddStr("key2", []byte(e.Key2)).AddStr("entry", data)
+	err = withTx(func(tx *DBTX) error {
+		_, err := tx.Insert("audit", *rec)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	auditTail = e
+	return nil
+}
+
+// read the last entry of the log
+func loadAuditTail() error {
+	auditTail = AuditEntry{}
+	sc := Scanner{Cmp1: CMP_LE, Cmp2: CMP_GE}
+	if err := db.Scan("audit", &sc); err != nil {
+		return err
+	}
+	if !sc.Valid() {
+		return nil
+	}
+	rec := Record{}
+	sc.Deref(&rec)
+	return json.Unmarshal(rec.Get("entry").Str, &auditTail)
+}
+
+// Checks the chain of the whole audit log. Returns the number of
+// entries, or an error at the first missing or modified entry.
+func VerifyAudit() (int, error) {
+	sc := Scanner{Cmp1: CMP_GE, Cmp2: CMP_LE}
+	if err := db.Scan("audit", &sc); err != nil {
+		return 0, err
+	}
+	prev := AuditEntry{}
+	n := 0
+	for ; sc.Valid(); sc.Next() {
+		rec := Record{}
+		sc.Deref(&rec)
+		e := AuditEntry{}
+		if err := json.Unmarshal(rec.Get("entry").Str, &e); err != nil {
+			return n, fmt.Errorf("entry %d: %w", rec.Get("seq").I64, err)
+		}
+		switch {
+		case e.Seq != rec.Get("seq").I64:
+			return n, fmt.Errorf("entry %d: stored as %d", e.Seq, rec.Get("seq").I64)
+		case e.Uid != string(rec.Get("uid").Str) || e.Key != string(rec.Get("key").Str) ||
+			e.Key2 != string(rec.Get("key2").Str):
+			return n, fmt.Errorf("entry %d: the columns do not match", e.Seq)
+		case e.Seq != prev.Seq+1:
+			return n, fmt.Errorf("entry %d: missing entries after %d", e.Seq, prev.Seq)
+		case !bytes.Equal(e.Prev, prev.Hash):
+			return n, fmt.Errorf("entry %d: the chain is broken", e.Seq)
+		case !bytes.Equal(e.Hash, auditHash(e)):
+			return n, fmt.Errorf("entry %d: modified", e.Seq)
+		}
+		prev = e
+		n++
+	}
+	return n, nil
+}
+
+// Input: uid or key to look up. Returns a response with the
+// matching entries of the log, for an admin or an auditor.
+func doAuditQuery(request *Request, response *Response) {
+	if !isAdmin(request.Uid) && !isAuditor(request.Uid) {
+		return
+	}
+	cols, val := []string{"uid"}, request.Subject
+	if request.Key != "" {
+		cols, val = []string{"key", "key2"}, request.Key
+	}
+	if val == "" {
+		return
+	}
+	entries := map[int64]AuditEntry{}
+	for _, col := range cols {
+		sc := Scanner{
+			Cmp1: CMP_GE, Key1: *(&Record{}).AddStr(col, []byte(val)),
+			Cmp2: CMP_LE, Key2: *(&Record{}).AddStr(col, []byte(val)),
+			Cols: []string{"entry"},
+		}
+		if err := db.Scan("audit", &sc); err != nil {
+			return
+		}
+		for ; sc.Valid(); sc.Next() {
+			rec := Record{}
+			sc.Deref(&rec)
+			e := AuditEntry{}
+			if json.Unmarshal(rec.Get("entry").Str, &e) != nil {
+				return
+			}
+			entries[e.Seq] = e
+		}
+	}
+	response.Audit = []AuditEntry{}
+	for _, e := range entries {
+		response.Audit = append(response.Audit, e)
+	}
+	sort.Slice(response.Audit, func(i, j int) bool { return response.Audit[i].Seq < response.Audit[j].Seq })
+	response.Status = OK
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	. "db"
+	. "types"
+)
+
+func TestAudit(t *testing.T) {
+	mu.Lock()
+	defer mu.Unlock()
+	addUser("auditor1", ROLE_AUDITOR)
+	runFrom("audit-client", "al", Request{Op: CREATE, Key: "au1", Val: "v", Readers: []string{"al"}})
+	runFrom("audit-client", "al", Request{Op: READ, Key: "au1"})
+	runFrom("audit-client", "bo", Request{Op: READ, Key: "au1"})
+	runFrom("audit-client", "al", Request{Op: COPY, Src_key: "au1", Dst_key: "au2"})
+
+	if resp := runFrom("audit-client", "al", Request{Op: AUDIT_QUERY, Subject: "al"}); resp.Status != FAIL {
+		t.Errorf("expect a user to be denied")
+	}
+	resp := runFrom("audit-client", "auditor1", Request{Op: AUDIT_QUERY, Key: "au1"})
+	got := []string{}
+	for _, e := range resp.Audit {
+		got = append(got, e.Uid+":"+e.Op.String()+":"+e.Status.String())
+	}
+	if strings.Join(got, " ") != "al:CREATE:OK al:READ:OK bo:READ:FAIL al:COPY:FAIL" {
+		t.Errorf("bad entries: %v", got)
+	}
+	resp = runFrom("audit-client", "auditor1", Request{Op: AUDIT_QUERY, Subject: "bo"})
+	if len(resp.Audit) != 1 || resp.Audit[0].Client != "audit-client" || resp.Audit[0].Key != "au1" {
+		t.Errorf("bad entries: %+v", resp.Audit)
+	}
+
+	n, err := VerifyAudit()
+	if err != nil || n < 6 {
+		t.Fatalf("verify: %d %v", n, err)
+	}
+	// an edit and a removal are detected
+	row := (&Record{}).AddInt64("seq", resp.Audit[0].Seq)
+	db.Get("audit", row)
+	orig := row.Get("entry").Str
+	edited := strings.Replace(string(orig), `"status":"FAIL"`, `"status":"OK"`, 1)
+	row.Get("entry").Str = []byte(edited)
+	db.Update("audit", *row)
+	if _, err := VerifyAudit(); err == nil || !strings.Contains(err.Error(), "modified") {
+		t.Errorf("expect the edit to be detected, got %v", err)
+	}
+	db.Delete("audit", *row)
+	if _, err := VerifyAudit(); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("expect the removal to be detected, got %v", err)
+	}
+	row.Get("entry").Str = orig
+	db.Insert("audit", *row)
+	if _, err := VerifyAudit(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"maps"
+
+	. "db"
+	. "types"
+)
+
+// the operations allowed in a BATCH, the ones changing
+// sessions or users are not
+func batchable(op Operation) bool {
+	switch op {
+	case CREATE, DELETE, READ, WRITE, COPY, INCR, APPEND, RENAME, MODACL, REVACL, CHOWN, CHOWN_ACCEPT,
+		GROUP_CREATE, GROUP_ADD, GROUP_REMOVE, GROUP_LIST:
+		return true
+	}
+	return false
+}
+
+// the in-memory state a batch can change, restored when it fails
+type serverState struct {
+	keys    map[string]Key
+	kvstore map[string]interface{}
+	groups  map[string]Group
+	tail    AuditEntry
+}
+
+func saveState() serverState {
+	return serverState{
+		keys:    maps.Clone(Keys),
+		kvstore: maps.Clone(kvstore),
+		groups:  maps.Clone(Groups),
+		tail:    auditTail,
+	}
+}
+func (s serverState) restore() {
+	resetKeys(s.keys)
+	kvstore = s.kvstore
+	Groups = s.groups
+	auditTail = s.tail
+}
+
+// Input: client name and a list of requests. Returns a response with
+// the result of each request. The requests run in order in a single
+// transaction, and nothing is changed unless all of them succeed.
+func doBatch(client string, request *Request, response *Response) {
+	if len(request.Batch) == 0 {
+		fail(response, ERR_BAD_REQUEST, "empty batch")
+		return
+	}
+	for _, sub := range request.Batch {
+		if !batchable(sub.Op) {
+			fail(response, ERR_BAD_REQUEST, "%s cannot be batched", sub.Op)
+			return
+		}
+	}
+	saved := saveState()
+	tx := DBTX{}
+	db.Begin(&tx)
+	curTx = &tx
+	response.Results = []Response{}
+	ok := true
+	for _, sub := range request.Batch {
+		sub.Uid, sub.Mfa = request.Uid, request.Mfa
+		var result Response
+		result.Uid = request.Uid
+		doOp(client, &sub, &result)
+		response.Results = append(response.Results, result)
+		if result.Status != OK {
+			ok = false
+			break
+		}
+	}
+	curTx = nil
+	if !ok {
+		db.Abort(&tx)
+		saved.restore()
+		fail(response, ERR_FAILED, "request %d of the batch failed", len(response.Results)-1)
+		return
+	}
+	if err := db.Commit(&tx); err != nil {
+		saved.restore()
+		fail(response, ERR_FAILED, "commit: %v", err)
+		return
+	}
+	response.Status = OK
+}
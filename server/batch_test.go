@@ -0,0 +1,47 @@
+package server
+
+import (
+	"testing"
+
+	. "types"
+)
+
+func TestBatch(t *testing.T) {
+	mu.Lock()
+	defer mu.Unlock()
+	resetKeys(nil)
+	runOp("fbs", Request{Op: CREATE, Key: "b2", Val: "two", Copyfroms: []string{"fbs"}})
+
+	resp := runOp("fbs", Request{Op: BATCH, Batch: []Request{
+		{Op: CREATE, Key: "b1", Val: "one"},
+		{Op: MODACL, Key: "b1", Readers: []string{"fbs"}, Copytos: []string{"fbs"}},
+		{Op: COPY, Src_key: "b2", Dst_key: "b1"},
+		{Op: READ, Key: "b1"},
+	}})
+	if resp.Status != OK || len(resp.Results) != 4 || resp.Results[3].Val != "two" {
+		t.Fatalf("batch: %+v", resp)
+	}
+
+	// a failure undoes the earlier requests
+	resp = runOp("fbs", Request{Op: BATCH, Batch: []Request{
+		{Op: CREATE, Key: "b3", Val: "three"},
+		{Op: MODACL, Key: "b1", Readers: []string{}},
+		{Op: WRITE, Key: "b1", Val: "lost"},
+		{Op: READ, Key: "b1"},
+	}})
+	if resp.Status != FAIL || len(resp.Results) != 3 || resp.Results[2].Error != ERR_DENIED {
+		t.Errorf("expect the batch to stop at the write: %+v", resp)
+	}
+	if _, ok := getKey("b3"); ok || Keys["b3"].Owner != "" || kvstore["b3"] != nil {
+		t.Errorf("expect b3 to be rolled back")
+	}
+	if resp := runOp("fbs", Request{Op: READ, Key: "b1"}); resp.Status != OK || resp.Val != "two" {
+		t.Errorf("expect the acl of b1 to be kept: %+v", resp)
+	}
+	if resp := runOp("fbs", Request{Op: BATCH, Batch: []Request{{Op: LOGOUT}}}); resp.Error != ERR_BAD_REQUEST {
+		t.Errorf("expect LOGOUT to be rejected: %+v", resp)
+	}
+	if n, err := VerifyAudit(); err != nil {
+		t.Errorf("audit after a rollback: %d %v", n, err)
+	}
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"slices"
+	. "types"
+)
+
+// the effective principals of a key per right, filled by bfs on demand
+var rights = make(map[string]map[string][]string)
+
+// key -> right -> the users granted it only by entries with a condition,
+// with those conditions. Filled with rights and dropped with them.
+var conditional = make(map[string]map[string]map[string][]Condition)
+
+// key -> the keys having it in their indirects
+var referrers = make(map[string]map[string]bool)
+
+// All changes to Keys go through putKey and removeKey, which keep
+// referrers up to date and drop the cached rights depending on the key.
+func putKey(key string, k Key) {
+	if old, ok := Keys[key]; ok {
+		unlinkIndirects(key, old)
+	}
+	invalidate(key)
+	Keys[key] = k
+	for _, next := range k.Indirects {
+		if referrers[next] == nil {
+			referrers[next] = make(map[string]bool)
+		}
+		referrers[next][key] = true
+	}
+}
+func removeKey(key string) {
+	old, ok := Keys[key]
+	if !ok {
+		return
+	}
+	unlinkIndirects(key, old)
+	invalidate(key)
+	delete(Keys, key)
+}
+func unlinkIndirects(key string, k Key) {
+	for _, next := range k.Indirects {
+		delete(referrers[next], key)
+		if len(referrers[next]) == 0 {
+			delete(referrers, next)
+		}
+	}
+}
+
+// drop the cached rights of the key and of every key reaching it
+func invalidate(key string) {
+	visited := map[string]bool{key: true}
+	queue := []string{key}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		delete(rights, cur)
+		delete(conditional, cur)
+		for prev := range referrers[cur] {
+			if !visited[prev] {
+				visited[prev] = true
+				queue = append(queue, prev)
+			}
+		}
+	}
+}
+
+// groups can appear anywhere, a membership change drops everything
+func invalidateAll() {
+	rights = make(map[string]map[string][]string)
+	conditional = make(map[string]map[string]map[string][]Condition)
+}
+
+// replace Keys and rebuild the reverse indirects
+func resetKeys(keys map[string]Key) {
+	Keys = make(map[string]Key)
+	referrers = make(map[string]map[string]bool)
+	invalidateAll()
+	for key, k := range keys {
+		putKey(key, k)
+	}
+}
+
+func cachedBfs(key string, attr string) []string {
+	if cached, ok := rights[key][attr]; ok {
+		return slices.Clone(cached)
+	}
+	result := bfs(key, attr)
+	if rights[key] == nil {
+		rights[key] = make(map[string][]string)
+	}
+	rights[key][attr] = result
+	return slices.Clone(result)
+}
+
+func cachedConditions(key string, attr string) map[string][]Condition {
+	if cached, ok := conditional[key][attr]; ok {
+		return cached
+	}
+	result := grantConditions(key, attr)
+	if conditional[key] == nil {
+		conditional[key] = make(map[string]map[string][]Condition)
+	}
+	conditional[key][attr] = result
+	return result
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+	. "types"
+)
+
+func TestRightsCache(t *testing.T) {
+	resetKeys(nil)
+	createKey("fbs", "c1", map[string][]string{"readers": {"ab"}, "indirects": {"c2"}})
+	createKey("fbs", "c2", map[string][]string{"readers": {"cd"}, "indirects": {"c3"}})
+	createKey("fbs", "c3", map[string][]string{"readers": {"ef"}})
+	createKey("fbs", "other", map[string][]string{"readers": {"gh"}})
+	R("c1")
+	R("other")
+	// a change deep in the chain reaches the keys above
+	Modacl("fbs", "c3", map[string][]string{"readers": {"ij"}})
+	if !compare(R("c1"), []string{"ab", "cd", "ij"}) {
+		t.Errorf("stale rights: %v", R("c1"))
+	}
+	if _, ok := rights["other"]; !ok {
+		t.Errorf("expect an unrelated key to stay cached")
+	}
+	DeleteKey("fbs", "c2")
+	if !compare(R("c1"), []string{"ab"}) {
+		t.Errorf("stale rights after deleting: %v", R("c1"))
+	}
+	// the key comes back
+	createKey("fbs", "c2", map[string][]string{"readers": {"kl"}})
+	if !compare(R("c1"), []string{"ab", "kl"}) {
+		t.Errorf("stale rights after creating: %v", R("c1"))
+	}
+	Modacl("fbs", "c1", map[string][]string{"indirects": {}})
+	Modacl("fbs", "c2", map[string][]string{"readers": {"mn"}})
+	if !compare(R("c1"), []string{"ab"}) || len(referrers["c2"]) != 0 {
+		t.Errorf("stale reverse edges: %v %v", R("c1"), referrers)
+	}
+}
+
+// n keys, each having the next one in its indirects
+func deepKeys(n int) {
+	resetKeys(nil)
+	for i := 0; i < n; i++ {
+		putKey(fmt.Sprint("k", i), Key{
+			Readers:   []string{fmt.Sprint("u", i)},
+			Indirects: []string{fmt.Sprint("k", i+1)},
+		})
+	}
+}
+
+// one key having n keys in its indirects, which all point back to it
+func wideKeys(n int) {
+	resetKeys(nil)
+	root := Key{}
+	for i := 0; i < n; i++ {
+		root.Indirects = append(root.Indirects, fmt.Sprint("k", i+1))
+		putKey(fmt.Sprint("k", i+1), Key{Readers: []string{fmt.Sprint("u", i)}, Indirects: []string{"k0"}})
+	}
+	putKey("k0", root)
+}
+
+func benchRights(b *testing.B, setup func(int), read func(string, string) []string) {
+	setup(1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		read(fmt.Sprint("k", i%100), "readers")
+	}
+}
+
+func BenchmarkRightsDeep(b *testing.B)         { benchRights(b, deepKeys, cachedBfs) }
+func BenchmarkRightsDeepUncached(b *testing.B) { benchRights(b, deepKeys, bfs) }
+func BenchmarkRightsWide(b *testing.B)         { benchRights(b, wideKeys, cachedBfs) }
+func BenchmarkRightsWideUncached(b *testing.B) { benchRights(b, wideKeys, bfs) }
+
+// a write to the bottom of the chain invalidates every key above it
+func BenchmarkRightsDeepWrite(b *testing.B) {
+	deepKeys(1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		k := Keys["k999"]
+		putKey("k999", k)
+		cachedBfs("k0", "readers")
+	}
+}
@@ -0,0 +1,21 @@
+package server
+
+import (
+	. "db"
+	. "types"
+)
+
+// Input: request, the row of the key it changes and the response.
+// The version and the value of the row must be the expected ones.
+func checkExpected(request *Request, key string, rec *Record, response *Response) bool {
+	version := uint64(rec.Get("version").I64)
+	if v := request.Expected_version; v != nil && *v != version {
+		fail(response, ERR_CONFLICT, "%s is at version %d", key, version)
+		return false
+	}
+	if v := request.Expected_value; v != nil && !sameValue(rec, *v) {
+		fail(response, ERR_CONFLICT, "%s has another value", key)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"testing"
+	. "types"
+)
+
+func TestCompareAndSwap(t *testing.T) {
+	mu.Lock()
+	defer mu.Unlock()
+	version := func(v uint64) *uint64 { return &v }
+	value := func(v string) *string { return &v }
+
+	runOp("fbs", Request{Op: CREATE, Key: "cas1", Val: "v1", Readers: []string{"fbs"}, Writers: []string{"fbs"}, Copytos: []string{"fbs"}})
+	runOp("fbs", Request{Op: CREATE, Key: "cas2", Val: "v2", Copyfroms: []string{"fbs"}})
+	if resp := runOp("fbs", Request{Op: READ, Key: "cas1"}); resp.Status != OK || resp.Version != 1 {
+		t.Errorf("read: %+v", resp)
+	}
+	if resp := runOp("fbs", Request{Op: WRITE, Key: "cas1", Val: "v11", Expected_version: version(1)}); resp.Status != OK {
+		t.Errorf("write: %+v", resp)
+	}
+	// the version moved on
+	resp := runOp("fbs", Request{Op: WRITE, Key: "cas1", Val: "v12", Expected_version: version(1)})
+	if resp.Status != FAIL || resp.Error != ERR_CONFLICT {
+		t.Errorf("expect a conflict: %+v", resp)
+	}
+	if resp := runOp("fbs", Request{Op: WRITE, Key: "cas1", Val: "v12", Expected_value: value("v1")}); resp.Error != ERR_CONFLICT {
+		t.Errorf("expect a conflict on the value: %+v", resp)
+	}
+	if resp := runOp("fbs", Request{Op: COPY, Src_key: "cas2", Dst_key: "cas1", Expected_value: value("v11")}); resp.Status != OK {
+		t.Errorf("copy: %+v", resp)
+	}
+	if resp := runOp("fbs", Request{Op: READ, Key: "cas1"}); resp.Val != "v2" || resp.Version != 3 {
+		t.Errorf("read after copy: %+v", resp)
+	}
+	if resp := runOp("fbs", Request{Op: DELETE, Key: "cas1", Expected_version: version(2)}); resp.Error != ERR_CONFLICT {
+		t.Errorf("expect a conflict on delete: %+v", resp)
+	}
+	if resp := runOp("fbs", Request{Op: DELETE, Key: "cas1", Expected_version: version(3)}); resp.Status != OK {
+		t.Errorf("delete: %+v", resp)
+	}
+}
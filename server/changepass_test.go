@@ -0,0 +1,48 @@
+package server
+
+import (
+	"testing"
+
+	. "types"
+)
+
+func TestChangePassRestart(t *testing.T) {
+	connect()
+	if clientOp(Request{Op: REGISTER, Uid: "cp", Pass: "old"}) != OK {
+		t.Fatal("register")
+	}
+	if clientOp(Request{Op: LOGIN, Uid: "cp", Pass: "old"}) != OK {
+		t.Fatal("login")
+	}
+	// another session of the same user
+	mu.Lock()
+	sessionTable["other"] = Blindentry{Uid: "cp"}
+	mu.Unlock()
+	if clientOp(Request{Op: CHANGE_PASS, Old_pass: "old", New_pass: "new"}) != OK {
+		t.Fatal("change password")
+	}
+	mu.Lock()
+	if _, ok := sessionTable["other"]; ok {
+		t.Errorf("expect the other session to be revoked")
+	}
+	mu.Unlock()
+	if clientOp(Request{Op: LOGOUT}) != OK {
+		t.Fatal("logout")
+	}
+
+	// restart the server
+	mu.Lock()
+	db.Close()
+	shadow = nil
+	if err := startup(); err != nil {
+		t.Fatal(err)
+	}
+	mu.Unlock()
+	if clientOp(Request{Op: LOGIN, Uid: "cp", Pass: "old"}) != FAIL {
+		t.Errorf("expect the old password to fail")
+	}
+	if clientOp(Request{Op: LOGIN, Uid: "cp", Pass: "new"}) != OK {
+		t.Errorf("expect the new password to work")
+	}
+	clientOp(Request{Op: LOGOUT})
+}
@@ -0,0 +1,28 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Log the changes of the tables listed in KVSTORE_CDC, comma separated.
+// The credentials and the audit log, which has the requests already,
+// are never logged.
+func setupCapture() error {
+	names := []string{}
+	for _, name := range strings.Split(os.Getenv("KVSTORE_CDC"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if name == user.Name || name == mfa.Name || name == audit.Name || db.GetTableDef(name) == nil {
+			return fmt.Errorf("cannot capture the changes of %s", name)
+		}
+		names = append(names, name)
+	}
+	for _, name := range names {
+		db.Capture(name)
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package server
+
+import "testing"
+
+func TestSetupCapture(t *testing.T) {
+	mu.Lock()
+	defer mu.Unlock()
+	before := db.Captured(kv.Name)
+	for _, name := range []string{kv.Name, acl.Name} {
+		if !db.Captured(name) {
+			t.Cleanup(func() { db.StopCapture(name) })
+		}
+	}
+	for _, tables := range []string{"shadow", "key_value,mfa", "audit", "nope"} {
+		t.Setenv("KVSTORE_CDC", tables)
+		if err := setupCapture(); err == nil {
+			t.Errorf("expect %s to be refused", tables)
+		}
+	}
+	if db.Captured(kv.Name) != before {
+		t.Errorf("expect nothing captured from a refused list")
+	}
+	t.Setenv("KVSTORE_CDC", "key_value, acl")
+	if err := setupCapture(); err != nil {
+		t.Error(err)
+	}
+	if !db.Captured(kv.Name) || !db.Captured(acl.Name) {
+		t.Errorf("expect key_value and acl to be captured")
+	}
+}
@@ -0,0 +1,46 @@
+package server
+
+import "testing"
+
+func TestChown(t *testing.T) {
+	resetKeys(nil)
+	createKey("fbs", "ck", map[string][]string{"readers": {"ab"}, "coowners": {"cd", "ef"}})
+
+	// co-owners manage the acl but not the co-owners
+	if !Modacl("cd", "ck", map[string][]string{"writers": {"cd"}}) || Revacl("cd", "ck") == nil {
+		t.Errorf("expect a co-owner to modify the acl")
+	}
+	if Modacl("cd", "ck", map[string][]string{"coowners": {"cd"}}) || Chown("cd", "ck", "cd", false) {
+		t.Errorf("expect a co-owner to be denied")
+	}
+	if Modacl("ab", "ck", map[string][]string{"readers": {}}) {
+		t.Errorf("expect a reader to be denied")
+	}
+
+	// offered, then accepted
+	if !Chown("fbs", "ck", "ef", true) || Keys["ck"].Owner != "fbs" || Keys["ck"].Pending != "ef" {
+		t.Fatalf("bad pending transfer: %+v", Keys["ck"])
+	}
+	if AcceptChown("cd", "ck") || !AcceptChown("ef", "ck") {
+		t.Errorf("expect only the new owner to accept")
+	}
+	k := Keys["ck"]
+	if k.Owner != "ef" || k.Pending != "" || !compare(k.Coowners, []string{"cd"}) {
+		t.Errorf("bad transfer: %+v", k)
+	}
+	if AcceptChown("ef", "ck") {
+		t.Errorf("expect nothing to accept")
+	}
+
+	// immediate, and persisted
+	if Chown("ef", "ck", "group:team", false) || !Chown("ef", "ck", "gh", false) {
+		t.Errorf("bad immediate transfer")
+	}
+	Keys = nil
+	if err := loadACLs(); err != nil {
+		t.Fatal(err)
+	}
+	if Keys["ck"].Owner != "gh" || !DeleteKey("cd", "ck") {
+		t.Errorf("bad reloaded key: %+v", Keys["ck"])
+	}
+}
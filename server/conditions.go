@@ -0,0 +1,114 @@
+package server
+
+import (
+	"slices"
+	"time"
+
+	. "types"
+)
+
+// Input: a condition, the time and whether the session is MFA verified.
+func conditionHolds(c Condition, now time.Time, mfa bool) bool {
+	if c.Until != 0 && now.Unix() >= c.Until {
+		return false
+	}
+	if c.Mfa && !mfa {
+		return false
+	}
+	if c.From != "" || c.To != "" {
+		from, err1 := time.Parse("15:04", c.From)
+		to, err2 := time.Parse("15:04", c.To)
+		if err1 != nil || err2 != nil {
+			return false
+		}
+		now = now.UTC()
+		at := now.Hour()*60 + now.Minute()
+		start, end := from.Hour()*60+from.Minute(), to.Hour()*60+to.Minute()
+		if start <= end {
+			return start <= at && at < end
+		}
+		return at >= start || at < end // across midnight
+	}
+	return true
+}
+
+// check the times of a condition before it is stored
+func validCondition(c Condition) bool {
+	if (c.From == "") != (c.To == "") {
+		return false
+	}
+	if c.From == "" {
+		return true
+	}
+	_, err1 := time.Parse("15:04", c.From)
+	_, err2 := time.Parse("15:04", c.To)
+	return err1 == nil && err2 == nil
+}
+
+// Input: key, attr, user id uid and whether the session is MFA verified.
+// uid holds attr on key through an entry, of key or of its indirects,
+// whose condition holds now. The deny list of key still applies.
+func allowed(key string, attr string, uid string, mfa bool) bool {
+	if !slices.Contains(cachedBfs(key, attr), uid) {
+		return false
+	}
+	conds, ok := cachedConditions(key, attr)[uid]
+	if !ok {
+		return true // an entry without a condition
+	}
+	now := clock()
+	for _, c := range conds {
+		if conditionHolds(c, now, mfa) {
+			return true
+		}
+	}
+	return false
+}
+
+// Input: key and attr. Returns the users granted attr on key, through
+// key or its indirects, only by entries with a condition, and the
+// conditions of those entries.
+func grantConditions(key string, attr string) map[string][]Condition {
+	always := make(map[string]bool)
+	result := make(map[string][]Condition)
+	visited := make(map[string]bool)
+	queue := []string{key}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		k, ok := Keys[cur]
+		if visited[cur] || !ok {
+			continue
+		}
+		visited[cur] = true
+		for _, p := range KeyGetter[attr](k) {
+			c, ok := k.Conditions[attr][p]
+			for _, u := range expandPrincipals([]string{p}) {
+				if ok {
+					result[u] = append(result[u], c)
+				} else {
+					always[u] = true
+				}
+			}
+		}
+		queue = append(queue, k.Indirects...)
+	}
+	for u := range always {
+		delete(result, u)
+	}
+	return result
+}
+
+// the entries of a key whose condition does not hold now, per list
+func inactiveEntries(k Key, mfa bool) map[string][]string {
+	now := clock()
+	result := make(map[string][]string)
+	for attr, conds := range k.Conditions {
+		for _, p := range KeyGetter[attr](k) {
+			if c, ok := conds[p]; ok && !conditionHolds(c, now, mfa) {
+				result[attr] = append(result[attr], p)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"crypto_utils"
+	. "types"
+)
+
+func TestConditions(t *testing.T) {
+	now := time.Date(2026, 6, 1, 8, 30, 0, 0, time.UTC)
+	clock = func() time.Time { return now }
+	defer func() { clock = time.Now }()
+	mu.Lock()
+	defer mu.Unlock()
+	sessionTable["cond-client"] = Blindentry{Uid: "cd", SessionKey: crypto_utils.NewSessionKey(), State: SESSION}
+
+	resetKeys(nil)
+	createKey("fbs", "base", map[string][]string{"readers": {"cd"}})
+	createKey("fbs", "ck", map[string][]string{"readers": {"ab"}, "writers": {"ab", "cd"}, "indirects": {"base"}})
+	code := EditAcl("fbs", "ck", AclEdit{Conditions: map[string]map[string]Condition{
+		"readers": {"ab": {Until: now.Add(time.Hour).Unix()}},
+		"writers": {"ab": {From: "09:00", To: "17:00"}, "cd": {Mfa: true}},
+	}})
+	if code != ERR_NONE {
+		t.Fatal("set the conditions")
+	}
+	if EditAcl("fbs", "ck", AclEdit{Conditions: map[string]map[string]Condition{"readers": {"ab": {From: "9"}}}}) != ERR_BAD_REQUEST {
+		t.Errorf("expect a bad window to be rejected")
+	}
+	EditAcl("fbs", "base", AclEdit{Conditions: map[string]map[string]Condition{"readers": {"cd": {From: "22:00", To: "06:00"}}}})
+
+	if !allowed("ck", "readers", "ab", false) || allowed("ck", "writers", "ab", false) {
+		t.Errorf("bad rights of ab at 08:30")
+	}
+	// the inherited grant is outside its window
+	if allowed("ck", "readers", "cd", false) {
+		t.Errorf("expect cd to be denied at 08:30")
+	}
+	if inactive := inactiveEntries(Keys["ck"], false); !compare(inactive["writers"], []string{"ab", "cd"}) {
+		t.Errorf("bad inactive entries: %v", inactive)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if allowed("ck", "readers", "ab", false) || !allowed("ck", "writers", "ab", false) {
+		t.Errorf("bad rights of ab at 10:30")
+	}
+	now = now.Add(13 * time.Hour)
+	if !allowed("ck", "readers", "cd", false) {
+		t.Errorf("expect cd to read at 23:30")
+	}
+
+	// the write of cd needs a verified session
+	if resp := sessionOp("cond-client", Request{Op: WRITE, Key: "ck", Val: "v"}); resp.Status != FAIL {
+		t.Errorf("expect the write to fail without MFA")
+	}
+	resp := sessionOp("cond-client", Request{Op: MFA_ENROLL})
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(resp.Val.(string))
+	if resp.Status != OK || err != nil {
+		t.Fatalf("enroll: %+v", resp)
+	}
+	if resp := sessionOp("cond-client", Request{Op: MFA_ENROLL}); resp.Status != FAIL {
+		t.Errorf("expect enrolling again to need MFA")
+	}
+	if resp := sessionOp("cond-client", Request{Op: MFA_VERIFY, Otp: "000000"}); resp.Status != FAIL && totp(secret, now) != "000000" {
+		t.Errorf("expect a wrong code to fail")
+	}
+	if resp := sessionOp("cond-client", Request{Op: MFA_VERIFY, Otp: totp(secret, now.Add(-30*time.Second))}); resp.Status != OK {
+		t.Errorf("verify: %+v", resp)
+	}
+	if !allowed("ck", "writers", "cd", true) || allowed("ck", "writers", "cd", false) {
+		t.Errorf("bad MFA condition")
+	}
+
+	// the cached conditions follow the acl
+	now = now.Add(-13 * time.Hour)
+	EditAcl("fbs", "base", AclEdit{Conditions: map[string]map[string]Condition{"readers": {}}})
+	if !allowed("ck", "readers", "cd", false) {
+		t.Errorf("expect cd to read without the window")
+	}
+}
+
+func TestTotp(t *testing.T) {
+	// RFC 6238 test vector, the last 6 digits
+	if code := totp([]byte("12345678901234567890"), time.Unix(59, 0)); code != "287082" {
+		t.Errorf("got %s", code)
+	}
+}
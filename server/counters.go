@@ -0,0 +1,83 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	. "db"
+	. "types"
+)
+
+// Input: key k and delta, 1 if zero. Adds delta to the int value
+// of k. Returns a response with the new value.
+func doIncr(request *Request, response *Response) {
+	delta := request.Delta
+	if delta == 0 {
+		delta = 1
+	}
+	updateValue(request, response, func(rec *Record) (string, []byte, error) {
+		if rowType(rec) != VAL_INT {
+			return "", nil, fmt.Errorf("%s is not an int", request.Key)
+		}
+		n := rowValue(rec).(int64)
+		if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+			return "", nil, fmt.Errorf("%s overflows", request.Key)
+		}
+		return VAL_INT, []byte(strconv.FormatInt(n+delta, 10)), nil
+	})
+}
+
+// Input: key k and value v. Appends v to the string value of k, or
+// adds v as an element of the json array of k. Returns a response
+// with the new value.
+func doAppend(request *Request, response *Response) {
+	updateValue(request, response, func(rec *Record) (string, []byte, error) {
+		switch rowType(rec) {
+		case "", VAL_STRING:
+			s, ok := request.Val.(string)
+			if !ok {
+				return "", nil, fmt.Errorf("append a string to %s", request.Key)
+			}
+			return VAL_STRING, append(rec.Get("value").Str, s...), nil
+		case VAL_JSON:
+			list, ok := rowValue(rec).([]interface{})
+			if !ok {
+				return "", nil, fmt.Errorf("%s is not a list", request.Key)
+			}
+			val, err := json.Marshal(append(list, request.Val))
+			return VAL_JSON, val, err
+		}
+		return "", nil, fmt.Errorf("cannot append to %s", request.Key)
+	})
+}
+
+// Input: a request on a key and the change of its row. Applies the
+// change in one transaction if the user can write the key.
+func updateValue(request *Request, response *Response, change func(rec *Record) (string, []byte, error)) {
+	err := withTx(func(tx *DBTX) error {
+		rec, ok := getKey(request.Key)
+		if !ok || !allowed(request.Key, "writers", request.Uid, request.Mfa) {
+			return nil // explained by the right
+		}
+		tag, val, err := change(rec)
+		if err != nil {
+			fail(response, ERR_BAD_REQUEST, "%v", err)
+			return nil
+		}
+		new := (&Record{}).AddStr("key", []byte(request.Key)).AddStr("value", val)
+		new.AddInt64("expires", rec.Get("expires").I64).AddInt64("version", rec.Get("version").I64+1)
+		new.AddStr("type", []byte(tag))
+		if _, err := tx.Update("key_value", *new); err != nil {
+			return err
+		}
+		response.Val, response.Type = rowValue(new), rowType(new)
+		response.Version = uint64(new.Get("version").I64)
+		response.Status = OK
+		return nil
+	})
+	if err != nil {
+		response.Status = FAIL
+	}
+}
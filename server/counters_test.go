@@ -0,0 +1,46 @@
+package server
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	. "types"
+)
+
+func TestIncrAppend(t *testing.T) {
+	mu.Lock()
+	defer mu.Unlock()
+	var list interface{}
+	json.Unmarshal([]byte(`["a"]`), &list)
+	runOp("ic", Request{Op: CREATE, Key: "ic1", Val: 5, Writers: []string{"ic"}, Readers: []string{"ab"}})
+	runOp("ic", Request{Op: CREATE, Key: "ic2", Val: "log:", Writers: []string{"ic"}})
+	runOp("ic", Request{Op: CREATE, Key: "ic3", Val: list, Writers: []string{"ic"}})
+	runOp("ic", Request{Op: CREATE, Key: "ic4", Val: int64(math.MaxInt64), Writers: []string{"ic"}})
+
+	if resp := runOp("ic", Request{Op: INCR, Key: "ic1"}); resp.Status != OK || resp.Val != int64(6) || resp.Version != 2 {
+		t.Errorf("incr: %+v", resp)
+	}
+	if resp := runOp("ic", Request{Op: INCR, Key: "ic1", Delta: -10}); resp.Val != int64(-4) {
+		t.Errorf("incr by delta: %+v", resp)
+	}
+	if resp := runOp("ab", Request{Op: INCR, Key: "ic1"}); resp.Status != FAIL || resp.Error != ERR_DENIED {
+		t.Errorf("expect a reader to be denied: %+v", resp)
+	}
+	if resp := runOp("ic", Request{Op: INCR, Key: "ic2"}); resp.Error != ERR_BAD_REQUEST {
+		t.Errorf("expect no incr of a string: %+v", resp)
+	}
+	if resp := runOp("ic", Request{Op: INCR, Key: "ic4"}); resp.Error != ERR_BAD_REQUEST {
+		t.Errorf("expect an overflow: %+v", resp)
+	}
+
+	if resp := runOp("ic", Request{Op: APPEND, Key: "ic2", Val: "x"}); resp.Status != OK || resp.Val != "log:x" {
+		t.Errorf("append: %+v", resp)
+	}
+	resp := runOp("ic", Request{Op: APPEND, Key: "ic3", Val: "b"})
+	if got, _ := json.Marshal(resp.Val); resp.Status != OK || string(got) != `["a","b"]` {
+		t.Errorf("append to a list: %+v", resp)
+	}
+	if resp := runOp("ic", Request{Op: APPEND, Key: "ic1", Val: "x"}); resp.Error != ERR_BAD_REQUEST {
+		t.Errorf("expect no append to an int: %+v", resp)
+	}
+}
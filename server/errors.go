@@ -0,0 +1,103 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+
+	. "types"
+)
+
+// fail the response with an error code and a message
+func fail(response *Response, code ErrCode, format string, args ...interface{}) {
+	response.Status = FAIL
+	response.Error = code
+	response.Message = fmt.Sprintf(format, args...)
+}
+
+// Input: a failed request and its response. Sets the error code and
+// the message of the response, and for an ACL denial in explain mode
+// the evaluation of the right if the user manages the key.
+func explainFailure(request *Request, response *Response) {
+	if response.Status == OK || response.Error != ERR_NONE {
+		return
+	}
+	switch request.Op {
+	case READ:
+		checkRight(request, response, request.Key, "readers")
+	case WRITE:
+		if !validValue(request) || request.Ttl < 0 {
+			fail(response, ERR_BAD_REQUEST, "bad value or ttl")
+			return
+		}
+		checkRight(request, response, request.Key, "writers")
+	case INCR, APPEND:
+		checkRight(request, response, request.Key, "writers")
+	case COPY:
+		checkRight(request, response, request.Src_key, "copyfroms")
+		checkRight(request, response, request.Dst_key, "copytos")
+	case CREATE:
+		if !validValue(request) || request.Ttl < 0 {
+			fail(response, ERR_BAD_REQUEST, "bad value or ttl")
+		} else if _, ok := getKey(request.Key); ok {
+			fail(response, ERR_EXISTS, "key %s exists", request.Key)
+		}
+	case DELETE, MODACL, REVACL, RENAME:
+		if _, ok := Keys[request.Key]; !ok {
+			fail(response, ERR_NOT_FOUND, "key %s not found", request.Key)
+		} else {
+			fail(response, ERR_DENIED, "not allowed to manage %s", request.Key)
+		}
+	}
+	if response.Error == ERR_NONE {
+		response.Error = ERR_FAILED
+		response.Message = fmt.Sprintf("%s failed", request.Op)
+	}
+}
+
+// the key exists and the user holds attr on it
+func checkRight(request *Request, response *Response, key string, attr string) {
+	if response.Error != ERR_NONE {
+		return
+	}
+	if _, ok := getKey(key); !ok {
+		fail(response, ERR_NOT_FOUND, "key %s not found", key)
+		return
+	}
+	if allowed(key, attr, request.Uid, request.Mfa) {
+		return
+	}
+	fail(response, ERR_DENIED, "no %s right on %s", attr, key)
+	if request.Explain && canManage(Keys[key], request.Uid) {
+		response.Explain = append(response.Explain, explainRight(key, attr, request.Mfa))
+	}
+}
+
+// Input: key, attr and whether the caller passed MFA.
+// Returns how attr on key is evaluated for the caller.
+func explainRight(key string, attr string, mfa bool) Explain {
+	e := Explain{Key: key, Right: attr, Visited: []string{}, Inactive: []string{}}
+	now := clock()
+	visited := make(map[string]bool)
+	queue := []string{key}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		k, ok := Keys[cur]
+		if visited[cur] || !ok {
+			continue
+		}
+		visited[cur] = true
+		e.Visited = append(e.Visited, cur)
+		for _, p := range KeyGetter[attr](k) {
+			if c, ok := k.Conditions[attr][p]; ok && !conditionHolds(c, now, mfa) {
+				e.Inactive = append(e.Inactive, cur+":"+p)
+			}
+		}
+		queue = append(queue, k.Indirects...)
+	}
+	e.Granted = cachedBfs(key, attr)
+	slices.Sort(e.Granted)
+	e.Denied = expandPrincipals(KeyGetter["deny_"+attr](Keys[key]))
+	slices.Sort(e.Denied)
+	return e
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	. "types"
+)
+
+func TestErrors(t *testing.T) {
+	mu.Lock()
+	defer mu.Unlock()
+	resetKeys(nil)
+	runOp("fbs", Request{Op: CREATE, Key: "er2", Val: "v", Readers: []string{"ab"}, Deny_readers: []string{"cd"}})
+	runOp("fbs", Request{Op: CREATE, Key: "er1", Val: "v", Indirects: []string{"er2"}, Deny_readers: []string{"ab"}})
+
+	cases := []struct {
+		uid  string
+		req  Request
+		want ErrCode
+	}{
+		{"fbs", Request{Op: READ, Key: "nope"}, ERR_NOT_FOUND},
+		{"ab", Request{Op: READ, Key: "er1"}, ERR_DENIED},
+		{"fbs", Request{Op: WRITE, Key: "er1", Val: "v", Type: "int"}, ERR_BAD_REQUEST},
+		{"fbs", Request{Op: CREATE, Key: "er1", Val: "v"}, ERR_EXISTS},
+		{"ab", Request{Op: DELETE, Key: "er1"}, ERR_DENIED},
+		{"fbs", Request{Op: COPY, Src_key: "er1", Dst_key: "nope"}, ERR_DENIED},
+		{"fbs", Request{Op: GROUP_ADD, Group: "nope", Members: []string{"ab"}}, ERR_FAILED},
+	}
+	for _, c := range cases {
+		if resp := runOp(c.uid, c.req); resp.Status != FAIL || resp.Error != c.want || resp.Message == "" {
+			t.Errorf("%v: got %v %v %q", c.req.Op, resp.Status, resp.Error, resp.Message)
+		}
+	}
+	stale := uint64(9)
+	if resp := runOp("fbs", Request{Op: MODACL, Key: "er1", Expected_version: &stale}); resp.Status != FAIL || resp.Error != ERR_CONFLICT {
+		t.Errorf("modacl: %v %v", resp.Status, resp.Error)
+	}
+
+	// only the owner gets the explanation
+	if resp := runOp("ab", Request{Op: READ, Key: "er1", Explain: true}); resp.Explain != nil {
+		t.Errorf("expect no explanation for a reader: %+v", resp.Explain)
+	}
+	resp := runOp("fbs", Request{Op: READ, Key: "er1", Explain: true})
+	if got := fmt.Sprintf("%+v", resp.Explain); got != "[{Key:er1 Right:readers Visited:[er1 er2] Granted:[] Denied:[ab] Inactive:[]}]" {
+		t.Errorf("bad explanation: %s", got)
+	}
+	// the conditions are evaluated with the MFA state of the caller
+	runOp("fbs", Request{Op: CREATE, Key: "er3", Val: "v"})
+	runOp("fbs", Request{Op: MODACL, Key: "er3", Readers: []string{"xy"},
+		Conditions: map[string]map[string]Condition{"readers": {"xy": {Mfa: true}}}})
+	if resp := runOp("fbs", Request{Op: READ, Key: "er3", Explain: true}); len(resp.Explain) != 1 ||
+		!slices.Equal(resp.Explain[0].Inactive, []string{"er3:xy"}) {
+		t.Errorf("expect xy to be inactive without MFA: %+v", resp.Explain)
+	}
+	if resp := runOp("fbs", Request{Op: READ, Key: "er3", Explain: true, Mfa: true}); len(resp.Explain) != 1 ||
+		len(resp.Explain[0].Inactive) != 0 {
+		t.Errorf("expect xy to be active with MFA: %+v", resp.Explain)
+	}
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	. "db"
+	. "types"
+)
+
+// an ACL entry naming a group
+const GROUP_PREFIX = "group:"
+
+var groups = &TableDef{
+	Name:   "groups",
+	Types:  []uint32{TYPE_BYTES, TYPE_BYTES},
+	Cols:   []string{"name", "owner"},
+	PKeys:  1,
+	Prefix: 0,
+}
+var groupMembers = &TableDef{
+	Name:    "group_members",
+	Types:   []uint32{TYPE_BYTES, TYPE_BYTES},
+	Cols:    []string{"group", "member"},
+	PKeys:   2,
+	Prefix:  0,
+	Indexes: [][]string{{"member"}},
+	Refs:    []TableRef{{Cols: []string{"group"}, Table: "groups", Cascade: true}},
+}
+
+var Groups = make(map[string]Group)
+
+func CreateGroup(uid string, group string) bool {
+	if _, ok := Groups[group]; ok || group == "" || uid == "" {
+		return false
+	}
+	rec := (&Record{}).AddStr("name", []byte(group)).AddStr("owner", []byte(uid))
+	err := withTx(func(tx *DBTX) error {
+		_, err := tx.Insert("groups", *rec)
+		return err
+	})
+	if err != nil {
+		return false
+	}
+	Groups[group] = Group{Owner: uid, Members: []string{}}
+	return true
+}
+
+// Input: the owner of the group and the members to add or remove.
+// A member is a uid or group:<name> of an existing group.
+func UpdateGroup(uid string, group string, add []string, remove []string) bool {
+	g, ok := Groups[group]
+	if !ok || g.Owner != uid {
+		return false
+	}
+	for _, m := range add {
+		if name, ok := strings.CutPrefix(m, GROUP_PREFIX); ok {
+			if _, ok := Groups[name]; !ok {
+				return false
+			}
+		}
+	}
+	members := slices.Clone(g.Members)
+	err := withTx(func(tx *DBTX) error {
+		for _, m := range add {
+			if slices.Contains(members, m) {
+				continue
+			}
+			rec := (&Record{}).AddStr("group", []byte(group)).AddStr("member", []byte(m))
+			if _, err := tx.Insert("group_members", *rec); err != nil {
+				return err
+			}
+			members = append(members, m)
+		}
+		for _, m := range remove {
+			rec := (&Record{}).AddStr("group", []byte(group)).AddStr("member", []byte(m))
+			if _, err := tx.Delete("group_members", *rec); err != nil {
+				return err
+			}
+			members = slices.DeleteFunc(members, func(x string) bool { return x == m })
+		}
+		return nil
+	})
+	if err != nil {
+		return false
+	}
+	g.Members = members
+	Groups[group] = g
+	invalidateAll()
+	return true
+}
+
+// Input: user id uid. Returns the groups that uid owns
+// or belongs to, directly or through nested groups.
+func ListGroups(uid string) map[string][]string {
+	result := make(map[string][]string)
+	for name, g := range Groups {
+		if g.Owner == uid || slices.Contains(groupUsers(name), uid) {
+			result[name] = g.Members
+		}
+	}
+	return result
+}
+
+// the uids in a group, the nested groups are expanded
+func groupUsers(group string) []string {
+	return expandPrincipals([]string{GROUP_PREFIX + group})
+}
+
+// Replace group:<name> entries with their members, recursively.
+// A group is expanded at most once, so cycles terminate.
+func expandPrincipals(principals []string) []string {
+	visited := make(map[string]bool)
+	users := make(map[string]bool)
+	queue := slices.Clone(principals)
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		name, ok := strings.CutPrefix(p, GROUP_PREFIX)
+		if !ok {
+			users[p] = true
+			continue
+		}
+		if visited[name] {
+			continue
+		}
+		visited[name] = true
+		queue = append(queue, Groups[name].Members...)
+	}
+	result := make([]string, 0, len(users))
+	for u := range users {
+		result = append(result, u)
+	}
+	return result
+}
+
+// rebuild Groups from the groups and group_members tables
+func loadGroups() error {
+	Groups = make(map[string]Group)
+	sc := Scanner{Cmp1: CMP_GE, Cmp2: CMP_LE}
+	if err := db.Scan("groups", &sc); err != nil {
+		return err
+	}
+	for ; sc.Valid(); sc.Next() {
+		rec := Record{}
+		sc.Deref(&rec)
+		Groups[string(rec.Get("name").Str)] = Group{Owner: string(rec.Get("owner").Str), Members: []string{}}
+	}
+	sc = Scanner{Cmp1: CMP_GE, Cmp2: CMP_LE}
+	if err := db.Scan("group_members", &sc); err != nil {
+		return err
+	}
+	for ; sc.Valid(); sc.Next() {
+		rec := Record{}
+		sc.Deref(&rec)
+		name := string(rec.Get("group").Str)
+		g, ok := Groups[name]
+		if !ok {
+			return fmt.Errorf("member of an unknown group: %s", name)
+		}
+		g.Members = append(g.Members, string(rec.Get("member").Str))
+		Groups[name] = g
+	}
+	invalidateAll()
+	return nil
+}
+
+func doGroupCreate(request *Request, response *Response) {
+	if CreateGroup(request.Uid, request.Group) {
+		response.Status = OK
+	}
+}
+func doGroupAdd(request *Request, response *Response) {
+	if UpdateGroup(request.Uid, request.Group, request.Members, nil) {
+		response.Status = OK
+	}
+}
+func doGroupRemove(request *Request, response *Response) {
+	if UpdateGroup(request.Uid, request.Group, nil, request.Members) {
+		response.Status = OK
+	}
+}
+func doGroupList(request *Request, response *Response) {
+	response.Groups = ListGroups(request.Uid)
+	for name, members := range response.Groups {
+		members = slices.Clone(members) // the live members of the group
+		sort.Strings(members)
+		response.Groups[name] = members
+	}
+	response.Status = OK
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"slices"
+	"testing"
+
+	. "types"
+)
+
+func TestGroups(t *testing.T) {
+	resetKeys(nil)
+	if !CreateGroup("fbs", "team") || !CreateGroup("fbs", "leads") || !CreateGroup("gs", "other") {
+		t.Fatal("create groups")
+	}
+	if CreateGroup("gs", "team") {
+		t.Errorf("expect a duplicated group to fail")
+	}
+	if !UpdateGroup("fbs", "team", []string{"ab", "cd", "group:leads"}, nil) {
+		t.Errorf("add members")
+	}
+	if UpdateGroup("gs", "team", []string{"gs"}, nil) || UpdateGroup("fbs", "team", []string{"group:nope"}, nil) {
+		t.Errorf("expect adding to fail")
+	}
+	// a cycle
+	UpdateGroup("fbs", "leads", []string{"ef", "group:team"}, nil)
+
+	createKey("fbs", "gk", map[string][]string{"readers": {"group:team"}, "writers": {"group:leads", "xy"}})
+	if !compare(R("gk"), []string{"ab", "cd", "ef"}) || !compare(W("gk"), []string{"ab", "cd", "ef", "xy"}) {
+		t.Errorf("bad expansion: %v %v", R("gk"), W("gk"))
+	}
+	UpdateGroup("fbs", "team", nil, []string{"cd", "group:leads"})
+	if !compare(R("gk"), []string{"ab"}) {
+		t.Errorf("bad expansion after removing: %v", R("gk"))
+	}
+	list := ListGroups("ef")
+	if _, ok := list["leads"]; !ok || len(list) != 1 {
+		t.Errorf("bad list: %v", list)
+	}
+
+	// reload from the db
+	Groups = nil
+	if err := loadGroups(); err != nil {
+		t.Fatal(err)
+	}
+	if !compare(Groups["team"].Members, []string{"ab"}) || !slices.Contains(Groups["leads"].Members, "group:team") {
+		t.Errorf("bad groups: %v", Groups)
+	}
+
+	// the list is sorted, not the group
+	CreateGroup("fbs", "order")
+	UpdateGroup("fbs", "order", []string{"zz", "aa"}, nil)
+	var resp Response
+	doGroupList(&Request{Uid: "fbs"}, &resp)
+	if !slices.Equal(resp.Groups["order"], []string{"aa", "zz"}) || !slices.Equal(Groups["order"].Members, []string{"zz", "aa"}) {
+		t.Errorf("bad sort: %v %v", resp.Groups["order"], Groups["order"].Members)
+	}
+}
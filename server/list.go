@@ -0,0 +1,86 @@
+package server
+
+import (
+	"encoding/base64"
+	"strings"
+
+	. "db"
+	. "types"
+)
+
+const (
+	LIST_LIMIT     = 100  // the page size without a limit
+	LIST_MAX_LIMIT = 1000 // the largest page
+)
+
+// the cursor is the last key of the page, encoded
+func encodeCursor(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+func decodeCursor(cursor string) (string, bool) {
+	key, err := base64.RawURLEncoding.DecodeString(cursor)
+	return string(key), err == nil && len(key) > 0
+}
+
+// Input: prefix or start (inclusive) and end (exclusive), limit and cursor.
+// Returns a page of the keys the user can read, in key order, and a
+// cursor for the next page if there may be more.
+func doList(request *Request, response *Response) {
+	limit := request.Limit
+	if limit == 0 {
+		limit = LIST_LIMIT
+	}
+	if limit < 0 || limit > LIST_MAX_LIMIT || (request.Prefix != "" && (request.Start != "" || request.End != "")) {
+		fail(response, ERR_BAD_REQUEST, "bad limit or range")
+		return
+	}
+	start := request.Start
+	if request.Prefix != "" {
+		start = request.Prefix
+	}
+	sc := Scanner{Cmp1: CMP_GE, Key1: *(&Record{}).AddStr("key", []byte(start)), Cmp2: CMP_LE}
+	if request.Cursor != "" {
+		after, ok := decodeCursor(request.Cursor)
+		if !ok {
+			fail(response, ERR_BAD_REQUEST, "bad cursor")
+			return
+		}
+		if after >= start {
+			sc.Cmp1, sc.Key1 = CMP_GT, *(&Record{}).AddStr("key", []byte(after))
+		}
+	}
+	if request.End != "" {
+		sc.Cmp2, sc.Key2 = CMP_LT, *(&Record{}).AddStr("key", []byte(request.End))
+	}
+	if err := db.Scan("key_value", &sc); err != nil {
+		fail(response, ERR_FAILED, "%v", err)
+		return
+	}
+	now := clock().UnixNano()
+	response.Entries = []Entry{}
+	for ; sc.Valid(); sc.Next() {
+		rec := Record{}
+		sc.Deref(&rec)
+		key := string(rec.Get("key").Str)
+		if !strings.HasPrefix(key, request.Prefix) {
+			break
+		}
+		if expires := rec.Get("expires").I64; expires != 0 && expires <= now {
+			continue
+		}
+		if !allowed(key, "readers", request.Uid, request.Mfa) {
+			continue
+		}
+		if len(response.Entries) == limit {
+			response.Cursor = encodeCursor(response.Entries[limit-1].Key)
+			break
+		}
+		e := Entry{Key: key}
+		if request.Values {
+			e.Val, e.Type = rowValue(&rec), rowType(&rec)
+			e.Version = uint64(rec.Get("version").I64)
+		}
+		response.Entries = append(response.Entries, e)
+	}
+	response.Status = OK
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"testing"
+	. "types"
+)
+
+func TestList(t *testing.T) {
+	mu.Lock()
+	defer mu.Unlock()
+	keys := func(resp Response) []string {
+		out := []string{}
+		for _, e := range resp.Entries {
+			out = append(out, e.Key)
+		}
+		return out
+	}
+	for _, k := range []string{"lsa", "lsb", "lsc", "lsd", "lte"} {
+		runOp("ls", Request{Op: CREATE, Key: k, Val: k + "v", Readers: []string{"ls"}})
+	}
+	var resp Response
+	doOp("", &Request{Op: CREATE, Uid: "other", Key: "lsbb", Val: "x"}, &resp)
+
+	// the keys of other users are skipped
+	resp = runOp("ls", Request{Op: LIST, Prefix: "ls", Limit: 2})
+	if resp.Status != OK || !compare(keys(resp), []string{"lsa", "lsb"}) || resp.Cursor == "" {
+		t.Errorf("first page: %+v", resp)
+	}
+	resp = runOp("ls", Request{Op: LIST, Prefix: "ls", Limit: 2, Cursor: resp.Cursor})
+	// no more keys with the prefix
+	if !compare(keys(resp), []string{"lsc", "lsd"}) || resp.Cursor != "" {
+		t.Errorf("second page: %+v", resp)
+	}
+
+	resp = runOp("ls", Request{Op: LIST, Start: "lsc", End: "ltz", Values: true})
+	if !compare(keys(resp), []string{"lsc", "lsd", "lte"}) || resp.Entries[0].Val != "lscv" || resp.Entries[0].Version != 1 {
+		t.Errorf("range: %+v", resp)
+	}
+	if resp := runOp("ls", Request{Op: LIST, Cursor: "!"}); resp.Status != FAIL || resp.Error != ERR_BAD_REQUEST {
+		t.Errorf("expect a bad cursor: %+v", resp)
+	}
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	. "db"
+	. "types"
+)
+
+// the TOTP secret of each user enrolled in MFA
+var mfa = &TableDef{
+	Name:   "mfa",
+	Types:  []uint32{TYPE_BYTES, TYPE_BYTES},
+	Cols:   []string{"uid", "secret"},
+	PKeys:  1,
+	Prefix: 0,
+}
+
+// the 6 digit code of a secret at a time, as RFC 6238 with 30s steps
+func totp(secret []byte, t time.Time) string {
+	msg := binary.BigEndian.AppendUint64(nil, uint64(t.Unix()/30))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+	off := sum[len(sum)-1] & 0xf
+	code := binary.BigEndian.Uint32(sum[off:]) & 0x7fffffff
+	return fmt.Sprintf("%06d", code%1000000)
+}
+
+func mfaSecret(uid string) ([]byte, bool) {
+	rec := (&Record{}).AddStr("uid", []byte(uid))
+	ok, err := getRow("mfa", rec)
+	if err != nil || !ok {
+		return nil, false
+	}
+	return rec.Get("secret").Str, true
+}
+
+// Input: user id uid, a one-time code and the time. The code of the
+// previous or the next step is accepted for the clock skew.
+func checkOtp(uid string, otp string, now time.Time) bool {
+	secret, ok := mfaSecret(uid)
+	if !ok || otp == "" {
+		return false
+	}
+	for _, step := range []time.Duration{0, -30 * time.Second, 30 * time.Second} {
+		if hmac.Equal([]byte(totp(secret, now.Add(step))), []byte(otp)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns a response with a new secret in the value. Replacing
+// the secret of an enrolled user needs a verified session.
+func doMfaEnroll(request *Request, response *Response) {
+	if _, ok := mfaSecret(request.Uid); ok && !request.Mfa {
+		return
+	}
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return
+	}
+	rec := (&Record{}).AddStr("uid", []byte(request.Uid)).AddStr("secret", secret)
+	err := withTx(func(tx *DBTX) error {
+		_, err := tx.Upsert("mfa", *rec)
+		return err
+	})
+	if err != nil {
+		return
+	}
+	response.Val = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret)
+	response.Status = OK
+}
+
+// Input: client name and a one-time code. Returns a response.
+// Marks the session of the client as MFA verified.
+func doMfaVerify(client string, request *Request, response *Response) {
+	entry, ok := sessionTable[client]
+	if !ok || entry.State != SESSION || !checkOtp(entry.Uid, request.Otp, clock()) {
+		return
+	}
+	entry.Mfa = true
+	sessionTable[client] = entry
+	response.Status = OK
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"testing"
+	. "types"
+)
+
+func TestRename(t *testing.T) {
+	mu.Lock()
+	defer mu.Unlock()
+	runOp("rn", Request{Op: CREATE, Key: "rn1", Val: "v", Readers: []string{"ab"}, Writers: []string{"rn"}})
+	runOp("rn", Request{Op: CREATE, Key: "rn2", Val: "w", Indirects: []string{"rn1"}})
+	runOp("rn", Request{Op: CREATE, Key: "rn3", Val: "x", Indirects: []string{"rn1"}})
+	runOp("cd", Request{Op: CREATE, Key: "rn4", Val: "y", Indirects: []string{"rn1"}})
+	runOp("rn", Request{Op: CREATE, Key: "rn5", Val: "z"})
+
+	if resp := runOp("ab", Request{Op: RENAME, Key: "rn1", New_key: "rnx"}); resp.Status != FAIL || resp.Error != ERR_DENIED {
+		t.Errorf("expect a reader to be denied: %+v", resp)
+	}
+	if resp := runOp("rn", Request{Op: RENAME, Key: "rn1", New_key: "rn5"}); resp.Error != ERR_EXISTS {
+		t.Errorf("expect an existing key: %+v", resp)
+	}
+	if resp := runOp("rn", Request{Op: RENAME, Key: "rn1", New_key: "rnx", Rewrite: true}); resp.Status != OK {
+		t.Fatalf("rename: %+v", resp)
+	}
+	if resp := runOp("ab", Request{Op: READ, Key: "rnx"}); resp.Status != OK || resp.Val != "v" {
+		t.Errorf("expect the ACL to move: %+v", resp)
+	}
+	if resp := runOp("rn", Request{Op: READ, Key: "rn1"}); resp.Error != ERR_NOT_FOUND {
+		t.Errorf("expect the old key to be gone: %+v", resp)
+	}
+	// only the keys of the owner follow
+	if !compare(Keys["rn2"].Indirects, []string{"rnx"}) || !compare(Keys["rn3"].Indirects, []string{"rnx"}) {
+		t.Errorf("expect the indirects to be rewritten: %v %v", Keys["rn2"].Indirects, Keys["rn3"].Indirects)
+	}
+	if !compare(Keys["rn4"].Indirects, []string{"rn1"}) {
+		t.Errorf("expect the key of another user to stay: %v", Keys["rn4"].Indirects)
+	}
+	if !compare(R("rn2"), []string{"ab"}) {
+		t.Errorf("expect the rights through the new name: %v", R("rn2"))
+	}
+}
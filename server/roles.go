@@ -0,0 +1,153 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	. "db"
+	. "types"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// the roles of users in the shadow table
+const (
+	ROLE_USER    = "user"
+	ROLE_ADMIN   = "admin"   // DELETE, MODACL and REVACL any key, manage the users
+	ROLE_AUDITOR = "auditor" // REVACL any key
+)
+
+// the user made admin at startup, from the KVSTORE_ADMIN environment variable
+var bootstrapAdmin = os.Getenv("KVSTORE_ADMIN")
+
+// Input: user id uid. Returns the role of uid, "" for no such user.
+func userRole(uid string) string {
+	rec, ok := userRow(uid)
+	if !ok {
+		return ""
+	}
+	if role := string(rec.Get("role").Str); role != "" {
+		return role
+	}
+	return ROLE_USER // registered before the roles
+}
+func isAdmin(uid string) bool {
+	return userRole(uid) == ROLE_ADMIN
+}
+func isAuditor(uid string) bool {
+	return userRole(uid) == ROLE_AUDITOR
+}
+func userLocked(uid string) bool {
+	rec, ok := userRow(uid)
+	return ok && rec.Get("locked").I64 != 0
+}
+
+// the row of a user in the shadow table
+func userRow(uid string) (*Record, bool) {
+	rec := (&Record{}).AddStr("uid", []byte(uid))
+	ok, err := getRow("shadow", rec)
+	return rec, ok && err == nil
+}
+
+// Input: user id uid and a function changing the row of uid.
+// Writes the changed row back to the shadow table.
+func updateUser(uid string, fn func(rec *Record)) bool {
+	rec, ok := userRow(uid)
+	if !ok {
+		return false
+	}
+	fn(rec)
+	return updateRow("shadow", *rec) == nil
+}
+
+// give the admin role to the bootstrap user, once registered
+func setupAdmin() error {
+	if _, ok := userRow(bootstrapAdmin); !ok || isAdmin(bootstrapAdmin) {
+		return nil // made admin by the registration
+	}
+	if !updateUser(bootstrapAdmin, func(rec *Record) { rec.Get("role").Str = []byte(ROLE_ADMIN) }) {
+		return fmt.Errorf("cannot make %s an admin", bootstrapAdmin)
+	}
+	return nil
+}
+
+// the role of a user registering
+func newUserRole(uid string) string {
+	if bootstrapAdmin != "" && uid == bootstrapAdmin {
+		return ROLE_ADMIN
+	}
+	return ROLE_USER
+}
+
+// Returns a response listing every user with its role.
+func doUserList(request *Request, response *Response) {
+	if !isAdmin(request.Uid) {
+		return
+	}
+	uids := make([]string, 0, len(shadow))
+	for uid := range shadow {
+		uids = append(uids, uid)
+	}
+	sort.Strings(uids)
+	response.Users = []UserInfo{}
+	for _, uid := range uids {
+		response.Users = append(response.Users, UserInfo{Uid: uid, Role: userRole(uid), Locked: userLocked(uid)})
+	}
+	response.Status = OK
+}
+
+// Input: user id, whether to lock. Returns a response. A locked user
+// cannot log in, and the current sessions are ended.
+func doUserLock(request *Request, response *Response, lock bool) {
+	if !isAdmin(request.Uid) || request.Subject == request.Uid {
+		return
+	}
+	ok := updateUser(request.Subject, func(rec *Record) {
+		rec.Get("locked").I64 = 0
+		if lock {
+			rec.Get("locked").I64 = 1
+		}
+	})
+	if !ok {
+		return
+	}
+	if lock {
+		revokeSessions(request.Subject, "")
+	}
+	response.Status = OK
+}
+
+// Input: user id and the new password. Returns a response.
+// The sessions of the user are ended.
+func doResetPass(request *Request, response *Response) {
+	if !isAdmin(request.Uid) || request.New_pass == "" {
+		return
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(request.New_pass), bcrypt.DefaultCost)
+	if err != nil {
+		return
+	}
+	if !updateUser(request.Subject, func(rec *Record) { rec.Get("password").Str = hashed }) {
+		return
+	}
+	shadow[request.Subject] = hashed
+	revokeSessions(request.Subject, "")
+	response.Status = OK
+}
+
+// Input: user id and a role. Returns a response.
+func doSetRole(request *Request, response *Response) {
+	switch request.Role {
+	case ROLE_USER, ROLE_ADMIN, ROLE_AUDITOR:
+	default:
+		return
+	}
+	// an admin cannot drop its own role, there is always one left
+	if !isAdmin(request.Uid) || request.Subject == request.Uid {
+		return
+	}
+	if updateUser(request.Subject, func(rec *Record) { rec.Get("role").Str = []byte(request.Role) }) {
+		response.Status = OK
+	}
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"testing"
+
+	"crypto_utils"
+	. "db"
+	. "types"
+)
+
+// register a user with a role and no usable password
+func addUser(uid string, role string) {
+	hashed := []byte("$2a$04$" + uid) // not a valid hash, only admin operations use it
+	rec := (&Record{}).AddStr("uid", []byte(uid)).AddStr("password", hashed).
+		AddStr("role", []byte(role)).AddInt64("locked", 0)
+	db.Upsert("shadow", *rec)
+	shadow[uid] = hashed
+}
+
+func TestRoles(t *testing.T) {
+	mu.Lock()
+	defer mu.Unlock()
+	addUser("root", ROLE_ADMIN)
+	addUser("audit", ROLE_AUDITOR)
+	addUser("plain", ROLE_USER)
+	sessionTable["plain-client"] = Blindentry{Uid: "plain", SessionKey: crypto_utils.NewSessionKey(), State: SESSION}
+
+	resetKeys(nil)
+	createKey("plain", "pk", map[string][]string{"readers": {"plain"}})
+	if Revacl("audit", "pk") == nil || Modacl("audit", "pk", map[string][]string{"readers": {}}) {
+		t.Errorf("expect an auditor to only review the acl")
+	}
+	if !Modacl("root", "pk", map[string][]string{"coowners": {"audit"}}) || Revacl("root", "pk") == nil {
+		t.Errorf("expect an admin to manage any acl")
+	}
+
+	if resp := runOp("plain", Request{Op: USER_LIST}); resp.Status != FAIL {
+		t.Errorf("expect a user to be denied")
+	}
+	resp := runOp("root", Request{Op: USER_LIST})
+	found := false
+	for _, u := range resp.Users {
+		found = found || u == UserInfo{Uid: "audit", Role: ROLE_AUDITOR}
+	}
+	if resp.Status != OK || !found {
+		t.Errorf("bad user list: %+v", resp)
+	}
+
+	if resp := runOp("root", Request{Op: USER_LOCK, Subject: "plain"}); resp.Status != OK || !userLocked("plain") {
+		t.Errorf("lock: %+v", resp)
+	}
+	if _, ok := sessionTable["plain-client"]; ok {
+		t.Errorf("expect the sessions of a locked user to end")
+	}
+	runOp("root", Request{Op: USER_UNLOCK, Subject: "plain"})
+	if userLocked("plain") {
+		t.Errorf("expect the user to be unlocked")
+	}
+
+	if resp := runOp("root", Request{Op: RESET_PASS, Subject: "plain", New_pass: "fresh"}); resp.Status != OK || !verifyPassword("plain", "fresh") {
+		t.Errorf("reset: %+v", resp)
+	}
+	if resp := runOp("root", Request{Op: SET_ROLE, Subject: "plain", Role: "king"}); resp.Status != FAIL {
+		t.Errorf("expect an unknown role to fail")
+	}
+	if resp := runOp("root", Request{Op: SET_ROLE, Subject: "root", Role: ROLE_USER}); resp.Status != FAIL {
+		t.Errorf("expect an admin to keep its own role")
+	}
+	runOp("root", Request{Op: SET_ROLE, Subject: "plain", Role: ROLE_ADMIN})
+	if !isAdmin("plain") || !DeleteKey("root", "pk") {
+		t.Errorf("expect plain to be an admin and root to delete any key")
+	}
+
+	// the bootstrap admin is made admin when it registers
+	saved := bootstrapAdmin
+	defer func() { bootstrapAdmin = saved }()
+	bootstrapAdmin = "boot"
+	if err := setupAdmin(); err != nil {
+		t.Errorf("expect no error before the registration: %v", err)
+	}
+	DoPhase2Register(Message{Uid: "boot", Pass: "pw"}, crypto_utils.NewSessionKey(), NetworkData{})
+	if !isAdmin("boot") {
+		t.Errorf("expect the bootstrap user to register as an admin")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"slices"
+	"sync"
 
 	"crypto_utils"
 	. "db"
@@ -20,20 +21,23 @@ var privateKey *rsa.PrivateKey
 var publicKey *rsa.PublicKey
 var shadow map[string][]byte
 var db DB
+
+// the database file, from the KVSTORE_DB environment variable
 var database = "test.db"
 var user = &TableDef{
 	Name:   "shadow",
-	Types:  []uint32{TYPE_BYTES, TYPE_BYTES},
-	Cols:   []string{"uid", "password"},
+	Types:  []uint32{TYPE_BYTES, TYPE_BYTES, TYPE_BYTES, TYPE_INT64},
+	Cols:   []string{"uid", "password", "role", "locked"},
 	PKeys:  1,
 	Prefix: 0,
 }
 var kv = &TableDef{
-	Name:   "key_value",
-	Types:  []uint32{TYPE_BYTES, TYPE_BYTES},
-	Cols:   []string{"key", "value"},
-	PKeys:  1,
-	Prefix: 0,
+	Name:    "key_value",
+	Types:   []uint32{TYPE_BYTES, TYPE_BYTES, TYPE_INT64, TYPE_INT64, TYPE_BYTES},
+	Cols:    []string{"key", "value", "expires", "version", "type"}, // expires: unix nanoseconds, 0 for never
+	PKeys:   1,
+	Prefix:  0,
+	Indexes: [][]string{{"expires"}},
 }
 
 // server blinding table C->{publicKey, uid, time}
@@ -42,39 +46,134 @@ var name string
 var kvstore map[string]interface{}
 var Requests chan NetworkData
 var Responses chan NetworkData
-var serverState State
-var sessionUID string
+
+// the server state is shared by the request loop and the sweeper
+var mu sync.Mutex
 
 func init() {
 	privateKey = crypto_utils.NewPrivateKey()
 	publicKey = &privateKey.PublicKey
-	publicKeyBytes := crypto_utils.PublicKeyToBytes(publicKey)
-	if err := os.WriteFile("SERVER_PUBLICKEY", publicKeyBytes, 0666); err != nil {
-		panic(err)
-	}
-	serverState = INIT
 	name = uuid.NewString()
 	kvstore = make(map[string]interface{})
 	sessionTable = make(map[string]Blindentry)
 	Requests = make(chan NetworkData)
 	Responses = make(chan NetworkData)
 	shadow = make(map[string][]byte)
-	sessionUID = ""
+	if path := os.Getenv("KVSTORE_DB"); path != "" {
+		database = path
+	}
+	go receiveThenSend()
+}
+
+// Writes the public key for the clients, opens the database and
+// starts the sweeper. Nothing is touched on disk before.
+func Start() error {
+	publicKeyBytes := crypto_utils.PublicKeyToBytes(publicKey)
+	if err := os.WriteFile("SERVER_PUBLICKEY", publicKeyBytes, 0666); err != nil {
+		return err
+	}
+	if err := startup(); err != nil {
+		return err
+	}
+	go sweeper()
+	return nil
+}
+
+// Open the database, create the missing tables,
+// then load the users, the keys and the ACLs.
+func startup() error {
 	db.Path = database
-	os.Remove(database)
-	db.Open()
+	if err := db.Open(); err != nil {
+		return err
+	}
 	// db.TableNew(TDEF_META)
+	for _, tdef := range []*TableDef{user, kv, acl, groups, groupMembers, mfa, audit} {
+		if err := ensureTable(tdef); err != nil {
+			return err
+		}
+	}
+	if err := setupCapture(); err != nil {
+		return err
+	}
+	if err := loadUsers(); err != nil {
+		return err
+	}
+	if err := loadKeys(); err != nil {
+		return err
+	}
+	if err := loadGroups(); err != nil {
+		return err
+	}
+	if err := setupAdmin(); err != nil {
+		return err
+	}
+	if err := loadAuditTail(); err != nil {
+		return err
+	}
+	return loadACLs()
+}
 
-	db.TableNew(user)
-	db.TableNew(kv)
-	go receiveThenSend()
+// Create a table unless it exists with the same columns. The columns,
+// indexes and constraints added to the definition are added to the table.
+func ensureTable(tdef *TableDef) error {
+	old := db.GetTableDef(tdef.Name)
+	if old == nil {
+		return db.TableNew(tdef)
+	}
+	n := len(old.Cols)
+	if n > len(tdef.Cols) || !slices.Equal(old.Cols, tdef.Cols[:n]) || !slices.Equal(old.Types, tdef.Types[:n]) {
+		return fmt.Errorf("table %s in %s has a different schema", tdef.Name, database)
+	}
+	// the new columns, indexes and constraints
+	return db.TableUpgrade(tdef)
+}
+
+// fill the shadow map from the shadow table
+func loadUsers() error {
+	sc := Scanner{Cmp1: CMP_GE, Cmp2: CMP_LE}
+	if err := db.Scan("shadow", &sc); err != nil {
+		return err
+	}
+	shadow = make(map[string][]byte)
+	for ; sc.Valid(); sc.Next() {
+		rec := Record{}
+		sc.Deref(&rec)
+		shadow[string(rec.Get("uid").Str)] = rec.Get("password").Str
+	}
+	return nil
+}
+
+// fill kvstore from the key_value table
+func loadKeys() error {
+	sc := Scanner{Cmp1: CMP_GE, Cmp2: CMP_LE, Cols: []string{"key", "value"}}
+	if err := db.Scan("key_value", &sc); err != nil {
+		return err
+	}
+	kvstore = make(map[string]interface{})
+	for ; sc.Valid(); sc.Next() {
+		rec := Record{}
+		sc.Deref(&rec)
+		kvstore[string(rec.Get("key").Str)] = string(rec.Get("value").Str)
+	}
+	return nil
+}
+
+// Runs a statement of the SQL console on the server's database,
+// serialized with the requests and the sweeper.
+func Exec(query string) (*QLResult, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	return db.Exec(query)
 }
 
 func receiveThenSend() {
 	defer close(Responses)
 
 	for request := range Requests {
-		Responses <- process(request)
+		mu.Lock()
+		response := process(request)
+		mu.Unlock()
+		Responses <- response
 	}
 }
 
@@ -83,14 +182,14 @@ func receiveThenSend() {
 // the corresponding operation. Returns the serialized
 // response. This method is invoked by the network.
 func process(requestData NetworkData) NetworkData {
-	if serverState == INIT {
+	// each client is in its own state
+	entry, ok := sessionTable[requestData.Name]
+	if !ok || entry.State == INIT {
 		// A --> S: {K_AS}Ks,{uid,"LOGIN",K_A,r,{uid,"LOGIN",K_A,r}k_A}K_AS
 		//          ||       ||
 		//          ||       ||
 		// A --> S: part1   ,part2
-		// fmt.Println("----S: state:", serverState)
 		if len(requestData.Payload) < 256 {
-			serverState = INIT
 			return failureMessage("")
 		}
 		part1 := requestData.Payload[:256]
@@ -120,15 +219,20 @@ func process(requestData NetworkData) NetworkData {
 			return failureMessage("")
 		}
 
-	} else if serverState == SESSION {
+	} else if entry.State == SESSION {
 		var request Request
 		var response Response
-		requestData.Payload, _ = crypto_utils.DecryptSK(requestData.Payload, sessionTable[requestData.Name].SessionKey)
-		response.Uid = sessionTable[requestData.Name].Uid
-		json.Unmarshal(requestData.Payload, &request)
-		doOp(&request, &response)
+		requestData.Payload, _ = crypto_utils.DecryptSK(requestData.Payload, entry.SessionKey)
+		response.Uid = entry.Uid
+		decodeRequest(requestData.Payload, &request)
+		request.Uid = entry.Uid // the user of the session
+		request.Mfa = sessionTable[requestData.Name].Mfa
+		doOp(requestData.Name, &request, &response)
+		if request.Op == CHANGE_PASS && response.Status == OK {
+			revokeSessions(response.Uid, requestData.Name)
+		}
 		responseBytes, _ := json.Marshal(response)
-		responseBytes = crypto_utils.EncryptSK(responseBytes, sessionTable[requestData.Name].SessionKey)
+		responseBytes = crypto_utils.EncryptSK(responseBytes, entry.SessionKey)
 		return NetworkData{Payload: responseBytes, Name: name}
 
 	}
@@ -143,8 +247,8 @@ func DoPhase2Register(verify_message Message, K_AS []byte, requestData NetworkDa
 		return failureMessage(verify_message.Uid)
 
 	} else {
-		rec := (&Record{}).AddStr("uid", []byte(verify_message.Uid)).AddStr("password", hashed)
-		fmt.Println(rec)
+		rec := (&Record{}).AddStr("uid", []byte(verify_message.Uid)).AddStr("password", hashed).
+			AddStr("role", []byte(newUserRole(verify_message.Uid))).AddInt64("locked", 0)
 		db.Insert("shadow", *rec)
 		Assert(true)
 		shadow[verify_message.Uid] = hashed
@@ -174,7 +278,7 @@ func verifyPassword(uid string, password string) bool {
 	_, ok := shadow[uid]
 	search_rec := (&Record{}).AddStr("uid", []byte(uid))
 
-	ok, _ = db.Get("shadow", search_rec)
+	ok, _ = getRow("shadow", search_rec)
 	if !ok {
 		return false
 	}
@@ -187,7 +291,7 @@ func verifyPassword(uid string, password string) bool {
 func DoPhase2Login(verify_message Message, K_AS []byte, requestData NetworkData) NetworkData {
 	// fmt.Println("Verify success")
 
-	if !verifyPassword(verify_message.Uid, verify_message.Pass) {
+	if !verifyPassword(verify_message.Uid, verify_message.Pass) || userLocked(verify_message.Uid) {
 		return failureMessage("")
 	}
 	newEntry := Blindentry{
@@ -195,10 +299,9 @@ func DoPhase2Login(verify_message Message, K_AS []byte, requestData NetworkData)
 		Tod:        verify_message.Time,
 		PublicKey:  verify_message.PublicKey,
 		SessionKey: K_AS,
+		State:      SESSION,
 	}
 	sessionTable[requestData.Name] = newEntry
-	sessionUID = verify_message.Uid
-	serverState = SESSION
 	tod := crypto_utils.TodToBytes(crypto_utils.ReadClock())
 	signature_message := Message{
 		Uid:    verify_message.Uid,
@@ -228,19 +331,24 @@ func failureMessage(uid string) NetworkData {
 	return NetworkData{Payload: responseBytes, Name: name}
 }
 
-// Input: request from a client. Returns a response.
+// Input: the client name and its request. Returns a response.
 // Parses request and handles a switch statement to
 // return the corresponding response to the request's
 // operation.
-func doOp(request *Request, response *Response) {
+func doOp(client string, request *Request, response *Response) {
+	defer func() {
+		if err := auditOp(client, request, response); err != nil {
+			fmt.Fprintln(os.Stderr, "audit:", err)
+		}
+	}()
 	response.Status = FAIL
 	switch request.Op {
 	case NOOP:
 		// NOTHING
 	case LOGIN:
-		doLogin(request, response)
+		doLogin(client, request, response)
 	case LOGOUT:
-		doLogout(request, response)
+		doLogout(client, request, response)
 	case CREATE:
 		doCreate(request, response)
 	case DELETE:
@@ -257,26 +365,97 @@ func doOp(request *Request, response *Response) {
 		doModacl(request, response)
 	case REVACL:
 		doRevacl(request, response)
+	case GROUP_CREATE:
+		doGroupCreate(request, response)
+	case GROUP_ADD:
+		doGroupAdd(request, response)
+	case GROUP_REMOVE:
+		doGroupRemove(request, response)
+	case GROUP_LIST:
+		doGroupList(request, response)
+	case CHOWN:
+		doChown(request, response)
+	case CHOWN_ACCEPT:
+		doChownAccept(request, response)
+	case ACCESS:
+		doAccess(request, response)
+	case MFA_ENROLL:
+		doMfaEnroll(request, response)
+	case MFA_VERIFY:
+		doMfaVerify(client, request, response)
+	case USER_LIST:
+		doUserList(request, response)
+	case USER_LOCK:
+		doUserLock(request, response, true)
+	case USER_UNLOCK:
+		doUserLock(request, response, false)
+	case RESET_PASS:
+		doResetPass(request, response)
+	case SET_ROLE:
+		doSetRole(request, response)
+	case AUDIT_QUERY:
+		doAuditQuery(request, response)
+	case BATCH:
+		doBatch(client, request, response)
+	case LIST:
+		doList(request, response)
+	case INCR:
+		doIncr(request, response)
+	case APPEND:
+		doAppend(request, response)
+	case RENAME:
+		doRename(request, response)
 
 	default:
 		// struct already default initialized to
 		// FAIL status
 	}
+	explainFailure(request, response)
 }
 
 func doModacl(request *Request, response *Response) {
-	if Modacl(
+	code := EditAcl(
 		request.Uid,
 		request.Key,
-		map[string][]string{
-			"readers":   request.Readers,
-			"writers":   request.Writers,
-			"copyfroms": request.Copyfroms,
-			"copytos":   request.Copytos,
-			"indirects": request.Indirects,
+		AclEdit{
+			Set: map[string][]string{
+				"readers":   request.Readers,
+				"writers":   request.Writers,
+				"copyfroms": request.Copyfroms,
+				"copytos":   request.Copytos,
+				"indirects": request.Indirects,
+				"coowners":  request.Coowners,
+
+				"deny_readers":   request.Deny_readers,
+				"deny_writers":   request.Deny_writers,
+				"deny_copyfroms": request.Deny_copyfroms,
+				"deny_copytos":   request.Deny_copytos,
+			},
+			Add: map[string][]string{
+				"readers":   request.Add_readers,
+				"writers":   request.Add_writers,
+				"copyfroms": request.Add_copyfroms,
+				"copytos":   request.Add_copytos,
+				"indirects": request.Add_indirects,
+				"coowners":  request.Add_coowners,
+			},
+			Remove: map[string][]string{
+				"readers":   request.Remove_readers,
+				"writers":   request.Remove_writers,
+				"copyfroms": request.Remove_copyfroms,
+				"copytos":   request.Remove_copytos,
+				"indirects": request.Remove_indirects,
+				"coowners":  request.Remove_coowners,
+			},
+			Version:    request.Expected_version,
+			Conditions: request.Conditions,
 		},
-	) {
+	)
+	switch code {
+	case ERR_NONE:
 		response.Status = OK
+	case ERR_CONFLICT:
+		fail(response, ERR_CONFLICT, "the acl of %s is at version %d", request.Key, Keys[request.Key].Version)
 	}
 }
 func doRevacl(request *Request, response *Response) {
@@ -292,6 +471,31 @@ func doRevacl(request *Request, response *Response) {
 		response.W = lists["W"]
 		response.C_src = lists["Csrc"]
 		response.C_dst = lists["Cdst"]
+		response.Owner = lists["owner"][0]
+		response.Coowners = lists["coowners"]
+		response.Acl_version = Keys[request.Key].Version
+		response.Conditions = Keys[request.Key].Conditions
+		response.Inactive = inactiveEntries(Keys[request.Key], request.Mfa)
+		response.Deny_readers = lists["deny_readers"]
+		response.Deny_writers = lists["deny_writers"]
+		response.Deny_copyfroms = lists["deny_copyfroms"]
+		response.Deny_copytos = lists["deny_copytos"]
+	}
+}
+
+// Input: key k, new owner and whether the new owner has to accept.
+// Returns a response. Only the owner of k can transfer it.
+func doChown(request *Request, response *Response) {
+	if Chown(request.Uid, request.Key, request.New_owner, request.Accept) {
+		response.Status = OK
+	}
+}
+
+// Input: key k. Returns a response. The user takes the
+// ownership of k offered by a CHOWN with accept.
+func doChownAccept(request *Request, response *Response) {
+	if AcceptChown(request.Uid, request.Key) {
+		response.Status = OK
 	}
 }
 
@@ -317,67 +521,112 @@ func doChangePassword(request *Request, response *Response) {
 	if verifyPassword(request.Uid, old_pass) {
 		hashed, err := bcrypt.GenerateFromPassword([]byte(new_pass), bcrypt.DefaultCost)
 		if err == nil {
-			shadow[request.Uid] = hashed
-			response.Status = OK
+			if updateUser(request.Uid, func(rec *Record) { rec.Get("password").Str = hashed }) {
+				shadow[request.Uid] = hashed
+				response.Status = OK
+			}
 		}
 	}
 	response.Uid = request.Uid
 
 }
 
+// Input: user id uid and the client name of the current session.
+// Ends the other sessions of the user, they have to log in with
+// the new password.
+func revokeSessions(uid string, keep string) {
+	for client, entry := range sessionTable {
+		if entry.Uid == uid && client != keep {
+			delete(sessionTable, client)
+		}
+	}
+}
+
 /** begin operation methods **/
-// Input: user id uid. Returns a response.
-// Begins session with user. If session already
-// exists then status is FAIL.
-func doLogin(request *Request, response *Response) {
-	if sessionUID == "" {
+// Input: client name and user id uid. Returns a response.
+// Begins session with user. If the client already
+// has a session then status is FAIL.
+func doLogin(client string, request *Request, response *Response) {
+	if entry, ok := sessionTable[client]; !ok || entry.State != SESSION {
 		response.Uid = request.Uid
 		response.Status = OK
 	} else {
 		response.Status = FAIL
-		response.Uid = sessionUID
+		response.Uid = entry.Uid
 	}
 }
 
-// Ends current session. Returns a response.
+// Ends the session of the client. Returns a response.
 // If no session exists then status is FAIL.
-func doLogout(request *Request, response *Response) {
-	if sessionUID != "" {
+func doLogout(client string, request *Request, response *Response) {
+	if entry, ok := sessionTable[client]; ok && entry.State == SESSION {
 		//"The same user u ends the current session"
-		response.Uid = sessionUID
-		sessionUID = ""
+		response.Uid = entry.Uid
+		delete(sessionTable, client)
 		response.Status = OK
-		serverState = INIT
 	}
 
 }
 
-// Input: key k, value v, metaval m. Returns a response.
+// Input: key k, value v, metaval m, optional ttl. Returns a response.
 // Sets the value and metaval for key k in the
 // key-value store to value v and metavalue m.
+// The key expires after ttl seconds if ttl is set.
 func doCreate(request *Request, response *Response) {
+	if request.Ttl < 0 {
+		return
+	}
+	if _, ok := kvstore[request.Key]; ok {
+		if _, ok := getKey(request.Key); !ok {
+			expireKey(request.Key) // expired but not swept yet
+		}
+	}
 	if _, ok := kvstore[request.Key]; !ok {
 		rec := (&Record{}).
 			AddStr("key", []byte(request.Key))
-		if val, ok := request.Val.(string); ok {
-			rec.AddStr("value", []byte(val))
-		} else {
-			response.Status = FAIL
+		tag, val, err := encodeValue(request.Val, request.Type)
+		if err != nil {
+			fail(response, ERR_BAD_REQUEST, "%v", err)
+			return
+		}
+		rec.AddStr("value", val)
+		rec.AddInt64("expires", expiresAt(request.Ttl)).AddInt64("version", 1).AddStr("type", []byte(tag))
+		// the value and its ACL are written together
+		created := false
+		err = withTx(func(tx *DBTX) error {
+			if _, err := tx.Insert("key_value", *rec); err != nil {
+				return err
+			}
+			ok := Create(
+				request.Uid,
+				request.Key,
+				map[string][]string{
+					"readers":   request.Readers,
+					"writers":   request.Writers,
+					"copyfroms": request.Copyfroms,
+					"copytos":   request.Copytos,
+					"indirects": request.Indirects,
+					"coowners":  request.Coowners,
+
+					"deny_readers":   request.Deny_readers,
+					"deny_writers":   request.Deny_writers,
+					"deny_copyfroms": request.Deny_copyfroms,
+					"deny_copytos":   request.Deny_copytos,
+				},
+			)
+			if !ok {
+				return fmt.Errorf("cannot create the ACL of %s", request.Key)
+			}
+			created = true
+			return nil
+		})
+		if err != nil {
+			if created {
+				removeKey(request.Key) // the commit failed
+			}
 			return
 		}
-		db.Insert("key_value", *rec)
 		kvstore[request.Key] = request.Val
-		Create(
-			request.Uid,
-			request.Key,
-			map[string][]string{
-				"readers":   request.Readers,
-				"writers":   request.Writers,
-				"copyfroms": request.Copyfroms,
-				"copytos":   request.Copytos,
-				"indirects": request.Indirects,
-			},
-		)
 		// __print_dac__()
 		response.Status = OK
 	}
@@ -389,66 +638,154 @@ func doCreate(request *Request, response *Response) {
 func doDelete(request *Request, response *Response) {
 	if _, ok := kvstore[request.Key]; ok {
 		if isOwner(request.Uid, request.Key) {
-			delete(kvstore, request.Key)
+			if row, ok := getKey(request.Key); ok && !checkExpected(request, request.Key, row, response) {
+				return
+			}
 			rec := (&Record{}).AddStr("key", []byte(request.Key))
-			db.Delete("key_value", *rec)
-			DeleteKey(request.Uid, request.Key)
+			err := withTx(func(tx *DBTX) error {
+				if _, err := tx.Delete("key_value", *rec); err != nil {
+					return err
+				}
+				return dropACL(request.Key)
+			})
+			if err != nil {
+				return
+			}
+			removeKey(request.Key)
+			delete(kvstore, request.Key)
 			response.Status = OK
 		}
 	}
 }
 
+// Input: key k, new_key and rewrite. Returns a response. Moves
+// the value and the ACL of k to new_key, for the owner. With rewrite
+// the indirects of the other keys of the owner follow the key.
+func doRename(request *Request, response *Response) {
+	rec, ok := getKey(request.Key)
+	if !ok || request.New_key == "" || Keys[request.Key].Owner != request.Uid {
+		return
+	}
+	if _, ok := kvstore[request.New_key]; ok {
+		if _, ok := getKey(request.New_key); !ok {
+			expireKey(request.New_key) // expired but not swept yet
+		}
+	}
+	if _, ok := kvstore[request.New_key]; ok {
+		fail(response, ERR_EXISTS, "key %s exists", request.New_key)
+		return
+	}
+	var changed map[string]Key
+	err := withTx(func(tx *DBTX) error {
+		if _, err := tx.Delete("key_value", *(&Record{}).AddStr("key", []byte(request.Key))); err != nil {
+			return err
+		}
+		new := (&Record{}).AddStr("key", []byte(request.New_key)).AddStr("value", rec.Get("value").Str)
+		new.AddInt64("expires", rec.Get("expires").I64).AddInt64("version", rec.Get("version").I64)
+		new.AddStr("type", rec.Get("type").Str)
+		if _, err := tx.Insert("key_value", *new); err != nil {
+			return err
+		}
+		var ok bool
+		if changed, ok = Rename(request.Uid, request.Key, request.New_key, request.Rewrite); !ok {
+			return fmt.Errorf("cannot rename the ACL of %s", request.Key)
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	removeKey(request.Key)
+	for name, k := range changed {
+		putKey(name, k)
+	}
+	kvstore[request.New_key] = kvstore[request.Key]
+	delete(kvstore, request.Key)
+	response.Status = OK
+}
+
 // Input: key src_key, value dst_key. Returns a response.
 // Change value in the key-value store associated with
 // key dst_key to value associated with key src_key.
 // If either key does not exist then status is FAIL.
 func doCopy(request *Request, response *Response) {
-	rec1 := (&Record{}).AddStr("key", []byte(request.Src_key))
-	ok1, _ := db.Get("key_value", rec1)
-	rec2 := (&Record{}).AddStr("key", []byte(request.Dst_key))
-	ok2, _ := db.Get("key_value", rec2)
-	if ok1 && slices.Contains(Csrc(request.Src_key), request.Uid) {
-		if ok2 && slices.Contains(Cdst(request.Dst_key), request.Uid) {
+	rec1, ok1 := getKey(request.Src_key)
+	rec2, ok2 := getKey(request.Dst_key)
+	if ok1 && allowed(request.Src_key, "copyfroms", request.Uid, request.Mfa) {
+		if ok2 && allowed(request.Dst_key, "copytos", request.Uid, request.Mfa) {
+			if !checkExpected(request, request.Dst_key, rec2, response) {
+				return
+			}
 			new := (&Record{}).AddStr("key", []byte(request.Dst_key))
 			new.AddStr("value", rec1.Get("value").Str)
-			db.Update("key_value", *new)
+			new.AddInt64("expires", rec2.Get("expires").I64)
+			new.AddInt64("version", rec2.Get("version").I64+1)
+			new.AddStr("type", rec1.Get("type").Str)
+			if updateRow("key_value", *new) != nil {
+				return
+			}
 			// kvstore[request.Dst_key] = kvstore[request.Src_key]
 			response.Status = OK
 		}
 	}
 }
 
-// Input: key k. Returns a response with the value
-// associated with key. If key does not exist
-// then status is FAIL.
+// Input: key k and an optional path into a json value.
+// Returns a response with the value associated with key.
+// If key does not exist then status is FAIL.
 func doReadVal(request *Request, response *Response) {
-	rec := (&Record{}).AddStr("key", []byte(request.Key))
-	ok, err := db.Get("key_value", rec)
+	rec, ok := getKey(request.Key)
 	// v, ok := kvstore[request.Key];
-	if err == nil && ok && slices.Contains(R(request.Key), request.Uid) {
-		response.Val = string(rec.Get("value").Str)
+	if ok && allowed(request.Key, "readers", request.Uid, request.Mfa) {
+		val := rowValue(rec)
+		if request.Path != "" {
+			if val, ok = pathGet(val, pathSegments(request.Path)); !ok || rowType(rec) != VAL_JSON {
+				fail(response, ERR_NOT_FOUND, "no %s in %s", request.Path, request.Key)
+				return
+			}
+			response.Type = valueType(val)
+		} else {
+			response.Type = rowType(rec)
+		}
+		response.Val = val
+		response.Version = uint64(rec.Get("version").I64)
 		response.Status = OK
 	}
 }
 
-// Input: key k and value v. Returns a response.
-// Change value in the key-value store associated
-// with key k to value v. If key does not exist
+// Input: key k, value v, optional ttl and optional path into
+// a json value. Returns a response. Change value in the key-value
+// store associated with key k to value v. If key does not exist
 // then status is FAIL.
 func doWriteVal(request *Request, response *Response) {
-	rec := (&Record{}).AddStr("key", []byte(request.Key))
-	ok, err := db.Get("key_value", rec)
+	rec, ok := getKey(request.Key)
 	// _, ok := kvstore[request.Key];
-	if err == nil && ok && slices.Contains(W(request.Key), request.Uid) {
+	if ok && request.Ttl >= 0 && allowed(request.Key, "writers", request.Uid, request.Mfa) {
+		if !checkExpected(request, request.Key, rec, response) {
+			return
+		}
 		new := (&Record{}).AddStr("key", []byte(request.Key))
-		if val, ok := request.Val.(string); ok {
-			new.AddStr("value", []byte(val))
-		} else {
-			response.Status = FAIL
+		tag, val, err := encodeValue(request.Val, request.Type)
+		if request.Path != "" {
+			tag = VAL_JSON
+			val, err = writePath(rec, request.Path, request.Val)
+		}
+		if err != nil {
+			fail(response, ERR_BAD_REQUEST, "%v", err)
 			return
 		}
+		new.AddStr("value", val)
+		// the expiry is kept unless a new ttl is given
+		expires := rec.Get("expires").I64
+		if request.Ttl > 0 {
+			expires = expiresAt(request.Ttl)
+		}
+		new.AddInt64("expires", expires).AddInt64("version", rec.Get("version").I64+1)
+		new.AddStr("type", []byte(tag))
 		// kvstore[request.Key] = request.Val
-		db.Update("key_value", *new)
+		if updateRow("key_value", *new) != nil {
+			return
+		}
 		response.Status = OK
 	}
 }
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"crypto_utils"
+	. "types"
+)
+
+// send a request in the session of a client
+func sessionOp(client string, request Request) Response {
+	key := sessionTable[client].SessionKey
+	payload, _ := json.Marshal(request)
+	out := process(NetworkData{Name: client, Payload: crypto_utils.EncryptSK(payload, key)})
+	var response Response
+	plain, err := crypto_utils.DecryptSK(out.Payload, key)
+	if err != nil {
+		json.Unmarshal(out.Payload, &response) // not in a session
+		return response
+	}
+	json.Unmarshal(plain, &response)
+	return response
+}
+
+func TestSessions(t *testing.T) {
+	mu.Lock()
+	defer mu.Unlock()
+	sessionTable["alice-client"] = Blindentry{Uid: "alice", SessionKey: crypto_utils.NewSessionKey(), State: SESSION}
+	sessionTable["bob-client"] = Blindentry{Uid: "bob", SessionKey: crypto_utils.NewSessionKey(), State: SESSION}
+
+	// the uid comes from the session, not from the request
+	resp := sessionOp("alice-client", Request{Op: CREATE, Uid: "bob", Key: "sess1", Val: "v", Readers: []string{"bob"}})
+	if resp.Status != OK || resp.Uid != "alice" || Keys["sess1"].Owner != "alice" {
+		t.Errorf("create: %+v", resp)
+	}
+	if resp := sessionOp("bob-client", Request{Op: READ, Key: "sess1"}); resp.Status != OK || resp.Uid != "bob" {
+		t.Errorf("read: %+v", resp)
+	}
+	if resp := sessionOp("bob-client", Request{Op: LOGIN, Uid: "carol"}); resp.Status != FAIL {
+		t.Errorf("expect a login in a session to fail")
+	}
+	// ending one session keeps the other
+	if resp := sessionOp("alice-client", Request{Op: LOGOUT}); resp.Status != OK || resp.Uid != "alice" {
+		t.Errorf("logout: %+v", resp)
+	}
+	if _, ok := sessionTable["alice-client"]; ok {
+		t.Errorf("expect the session to be removed")
+	}
+	if resp := sessionOp("bob-client", Request{Op: READ, Key: "sess1"}); resp.Status != OK {
+		t.Errorf("read after the other logout: %+v", resp)
+	}
+	delete(sessionTable, "bob-client")
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"os"
+	"testing"
+
+	"client"
+	. "db"
+	. "types"
+)
+
+// the tests run on an empty database, in a directory of their own
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "server")
+	if err != nil {
+		panic(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		panic(err)
+	}
+	mu.Lock()
+	database = dir + "/test.db"
+	if err := Start(); err != nil {
+		panic(err)
+	}
+	mu.Unlock()
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// run a request of uid outside of a session
+func runOp(uid string, req Request) Response {
+	return runFrom("", uid, req)
+}
+
+// run a request of uid from a client, outside of a session
+func runFrom(client string, uid string, req Request) Response {
+	req.Uid = uid
+	var resp Response
+	doOp(client, &req, &resp)
+	return resp
+}
+
+// relay the client requests to the server, like the network package
+func connect() {
+	client.ObtainServerPublicKey()
+	go func() {
+		for request := range client.Requests {
+			Requests <- request
+			client.Responses <- <-Responses
+		}
+	}()
+}
+
+// run a request through the client, connected first
+func clientOp(req Request) Code {
+	return client.ProcessOp(&req).Status
+}
+
+// create the ACL of a key, with an empty value for the acl to refer to
+func createKey(uid string, key string, metadata map[string][]string) bool {
+	rec := (&Record{}).AddStr("key", []byte(key)).AddStr("value", nil).
+		AddInt64("expires", 0).AddInt64("version", 1).AddStr("type", []byte(VAL_STRING))
+	withTx(func(tx *DBTX) error {
+		tx.Insert("key_value", *rec)
+		return nil
+	})
+	return Create(uid, key, metadata)
+}
+
+func TestRestart(t *testing.T) {
+	mu.Lock()
+	defer mu.Unlock()
+	rec := (&Record{}).AddStr("uid", []byte("restart")).AddStr("password", []byte("hash")).
+		AddStr("role", []byte(ROLE_USER)).AddInt64("locked", 0)
+	db.Upsert("shadow", *rec)
+	var resp Response
+	doOp("", &Request{Op: CREATE, Uid: "restart", Key: "restart1", Val: "v1", Readers: []string{"gs"}}, &resp)
+
+	db.Close()
+	shadow, kvstore, Keys = nil, nil, nil
+	if err := startup(); err != nil {
+		t.Fatal(err)
+	}
+	if string(shadow["restart"]) != "hash" {
+		t.Errorf("expect the user to be loaded")
+	}
+	if kvstore["restart1"] != "v1" {
+		t.Errorf("expect the key to be loaded")
+	}
+	if k := Keys["restart1"]; k.Owner != "restart" || !compare(k.Readers, []string{"gs"}) {
+		t.Errorf("bad ACL: %+v", k)
+	}
+	// the existing tables are kept
+	if err := ensureTable(kv); err != nil {
+		t.Error(err)
+	}
+	bad := *kv
+	bad.Cols = []string{"key", "value"}
+	if err := ensureTable(&bad); err == nil {
+		t.Errorf("expect a schema error")
+	}
+}
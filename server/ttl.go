@@ -0,0 +1,107 @@
+package server
+
+import (
+	"time"
+
+	"crypto_utils"
+	. "db"
+	. "types"
+)
+
+// the number of expired keys deleted at a time
+const SWEEP_BATCH = 100
+
+var sweepInterval = time.Second
+var clock = crypto_utils.ReadClock
+
+// the expiry time of a key created now, 0 for no expiry
+func expiresAt(ttl int64) int64 {
+	if ttl == 0 {
+		return 0
+	}
+	return clock().Add(time.Duration(ttl) * time.Second).UnixNano()
+}
+
+// Input: key k. Returns the row of key k,
+// an expired key is treated as absent.
+func getKey(key string) (*Record, bool) {
+	rec := (&Record{}).AddStr("key", []byte(key))
+	ok, err := getRow("key_value", rec)
+	if err != nil || !ok {
+		return nil, false
+	}
+	expires := rec.Get("expires").I64
+	if expires != 0 && expires <= clock().UnixNano() {
+		return nil, false
+	}
+	return rec, true
+}
+
+// remove a key with its ACL
+func expireKey(key string) {
+	expireKeys([]string{key})
+}
+
+// remove keys with their ACLs in one transaction
+func expireKeys(keys []string) bool {
+	err := withTx(func(tx *DBTX) error {
+		for _, key := range keys {
+			if _, err := tx.Delete("key_value", *(&Record{}).AddStr("key", []byte(key))); err != nil {
+				return err
+			}
+			if err := dropACL(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false
+	}
+	for _, key := range keys {
+		delete(kvstore, key)
+		removeKey(key)
+	}
+	return true
+}
+
+// Deletes up to batch expired keys, returns the number of deleted
+// keys, 0 if they cannot be deleted.
+func sweepExpired(batch int) int {
+	sc := Scanner{
+		Cmp1: CMP_GE, Key1: *(&Record{}).AddInt64("expires", 1),
+		Cmp2: CMP_LE, Key2: *(&Record{}).AddInt64("expires", clock().UnixNano()),
+		Cols: []string{"key"},
+	}
+	if err := db.Scan("key_value", &sc); err != nil {
+		return 0
+	}
+	keys := []string{}
+	for ; sc.Valid() && len(keys) < batch; sc.Next() {
+		rec := Record{}
+		sc.Deref(&rec)
+		keys = append(keys, string(rec.Get("key").Str))
+	}
+	if !expireKeys(keys) {
+		return 0
+	}
+	return len(keys)
+}
+
+// delete the expired keys and the consumed changes in the
+// background, the requests are served in between the batches.
+func sweeper() {
+	for range time.Tick(sweepInterval) {
+		for {
+			mu.Lock()
+			n := sweepExpired(SWEEP_BATCH)
+			mu.Unlock()
+			if n < SWEEP_BATCH {
+				break // done, or no progress
+			}
+		}
+		mu.Lock()
+		db.TrimConsumed()
+		mu.Unlock()
+	}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"testing"
+	"time"
+	. "types"
+)
+
+func TestTTL(t *testing.T) {
+	now := time.Now()
+	clock = func() time.Time { return now }
+	defer func() { clock = time.Now }()
+	mu.Lock()
+	defer mu.Unlock()
+
+	runOp("fbs", Request{Op: CREATE, Key: "ttl1", Val: "v1", Ttl: 10})
+	runOp("fbs", Request{Op: CREATE, Key: "ttl2", Val: "v2", Ttl: 20, Readers: []string{"fbs"}, Writers: []string{"fbs"}})
+	runOp("fbs", Request{Op: CREATE, Key: "ttl3", Val: "v3", Readers: []string{"fbs"}})
+	if resp := runOp("fbs", Request{Op: CREATE, Key: "ttl4", Val: "v4", Ttl: -1}); resp.Status != FAIL {
+		t.Errorf("expect a failure for a negative ttl")
+	}
+
+	now = now.Add(15 * time.Second)
+	if resp := runOp("fbs", Request{Op: READ, Key: "ttl1"}); resp.Status != FAIL {
+		t.Errorf("expect an expired key to be absent")
+	}
+	// a write without a ttl keeps the expiry
+	if resp := runOp("fbs", Request{Op: WRITE, Key: "ttl2", Val: "v22"}); resp.Status != OK {
+		t.Errorf("write: %v", resp.Status)
+	}
+	if resp := runOp("fbs", Request{Op: READ, Key: "ttl2"}); resp.Status != OK || resp.Val != "v22" {
+		t.Errorf("read: %v %v", resp.Status, resp.Val)
+	}
+	if n := sweepExpired(SWEEP_BATCH); n != 1 {
+		t.Errorf("swept %d keys", n)
+	}
+	if _, ok := Keys["ttl1"]; ok {
+		t.Errorf("expect the ACL to be removed")
+	}
+
+	now = now.Add(10 * time.Second)
+	if n := sweepExpired(SWEEP_BATCH); n != 1 {
+		t.Errorf("swept %d keys", n)
+	}
+	if resp := runOp("fbs", Request{Op: READ, Key: "ttl3"}); resp.Status != OK {
+		t.Errorf("expect a key without ttl to stay")
+	}
+	// the key can be created again
+	if resp := runOp("fbs", Request{Op: CREATE, Key: "ttl2", Val: "new"}); resp.Status != OK {
+		t.Errorf("create: %v", resp.Status)
+	}
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	. "db"
+	. "types"
+)
+
+// the type tags of the values, a row without a tag holds a string
+const (
+	VAL_STRING = "string"
+	VAL_INT    = "int"
+	VAL_FLOAT  = "float"
+	VAL_BOOL   = "bool"
+	VAL_JSON   = "json" // an object or an array
+	VAL_BYTES  = "bytes"
+)
+
+// decode a request, keeping the numbers exact
+func decodeRequest(data []byte, request *Request) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(request)
+}
+
+// Input: a value and its type tag, inferred if empty.
+// Returns the tag and the bytes to store.
+func encodeValue(val interface{}, tag string) (string, []byte, error) {
+	switch v := val.(type) {
+	case string:
+		switch tag {
+		case "", VAL_STRING:
+			return VAL_STRING, []byte(v), nil
+		case VAL_BYTES:
+			b, err := base64.StdEncoding.DecodeString(v)
+			return VAL_BYTES, b, err
+		}
+	case bool:
+		if tag == "" || tag == VAL_BOOL {
+			return VAL_BOOL, []byte(strconv.FormatBool(v)), nil
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil && tag != VAL_FLOAT {
+			return encodeValue(i, tag)
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return "", nil, err
+		}
+		return encodeValue(f, tag)
+	case int:
+		return encodeValue(int64(v), tag)
+	case int64:
+		switch tag {
+		case "", VAL_INT:
+			return VAL_INT, []byte(strconv.FormatInt(v, 10)), nil
+		case VAL_FLOAT:
+			return encodeValue(float64(v), tag)
+		}
+	case float64:
+		switch {
+		case tag == VAL_INT && v == math.Trunc(v):
+			return encodeValue(int64(v), tag)
+		case tag == "" && v == math.Trunc(v) && math.Abs(v) < 1<<53:
+			return encodeValue(int64(v), tag)
+		case tag == "" || tag == VAL_FLOAT:
+			return VAL_FLOAT, []byte(strconv.FormatFloat(v, 'g', -1, 64)), nil
+		}
+	case map[string]interface{}, []interface{}:
+		if tag == "" || tag == VAL_JSON {
+			b, err := json.Marshal(v)
+			return VAL_JSON, b, err
+		}
+	}
+	return "", nil, fmt.Errorf("bad value for type %q", tag)
+}
+
+// the value of a CREATE or WRITE can be stored
+func validValue(request *Request) bool {
+	if request.Path != "" {
+		return true // set inside the json value
+	}
+	_, _, err := encodeValue(request.Val, request.Type)
+	return err == nil
+}
+
+// Input: the type tag and the bytes of a stored value. Returns the value.
+func decodeValue(tag string, data []byte) interface{} {
+	switch tag {
+	case VAL_INT:
+		i, _ := strconv.ParseInt(string(data), 10, 64)
+		return i
+	case VAL_FLOAT:
+		f, _ := strconv.ParseFloat(string(data), 64)
+		return f
+	case VAL_BOOL:
+		return string(data) == "true"
+	case VAL_BYTES:
+		return base64.StdEncoding.EncodeToString(data)
+	case VAL_JSON:
+		var v interface{}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		dec.Decode(&v)
+		return v
+	}
+	return string(data)
+}
+
+// the value of a key_value row
+func rowValue(rec *Record) interface{} {
+	return decodeValue(string(rec.Get("type").Str), rec.Get("value").Str)
+}
+
+// the tag returned with a value, none for a string
+func rowType(rec *Record) string {
+	if tag := string(rec.Get("type").Str); tag != VAL_STRING {
+		return tag
+	}
+	return ""
+}
+
+// the tag of a value inside a json value, none for a string or a null
+func valueType(val interface{}) string {
+	if tag, _, err := encodeValue(val, ""); err == nil && tag != VAL_STRING {
+		return tag
+	}
+	return ""
+}
+
+// Input: a row and a value in the form READ returns it, the JSON
+// of the value unless it is a string or bytes. Returns if they are equal.
+func sameValue(rec *Record, expected string) bool {
+	if v, ok := rowValue(rec).(string); ok {
+		return v == expected
+	}
+	var val interface{}
+	dec := json.NewDecoder(strings.NewReader(expected))
+	dec.UseNumber()
+	if dec.Decode(&val) != nil {
+		return false
+	}
+	_, data, err := encodeValue(val, rowType(rec))
+	return err == nil && bytes.Equal(data, rec.Get("value").Str)
+}
+
+// Input: a json row, a path and a value. Returns the
+// document of the row with the value at the path.
+func writePath(rec *Record, path string, val interface{}) ([]byte, error) {
+	if rowType(rec) != VAL_JSON {
+		return nil, fmt.Errorf("not a json value")
+	}
+	doc, ok := pathSet(rowValue(rec), pathSegments(path), val)
+	if !ok {
+		return nil, fmt.Errorf("bad path %s", path)
+	}
+	return json.Marshal(doc)
+}
+
+// the segments of a path like a.b.0, the numbers index the arrays
+func pathSegments(path string) []string {
+	return strings.Split(strings.TrimPrefix(path, "$."), ".")
+}
+
+// Input: a JSON document and a path. Returns the value at the path.
+func pathGet(doc interface{}, segs []string) (interface{}, bool) {
+	for _, seg := range segs {
+		switch d := doc.(type) {
+		case map[string]interface{}:
+			v, ok := d[seg]
+			if !ok {
+				return nil, false
+			}
+			doc = v
+		case []interface{}:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(d) {
+				return nil, false
+			}
+			doc = d[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// Input: a JSON document, a path and a value. Returns the document with
+// the value at the path, the missing members of the objects are added.
+func pathSet(doc interface{}, segs []string, val interface{}) (interface{}, bool) {
+	if len(segs) == 0 {
+		return val, true
+	}
+	switch d := doc.(type) {
+	case nil:
+		child, ok := pathSet(nil, segs[1:], val)
+		return map[string]interface{}{segs[0]: child}, ok
+	case map[string]interface{}:
+		child, ok := pathSet(d[segs[0]], segs[1:], val)
+		d[segs[0]] = child
+		return d, ok
+	case []interface{}:
+		i, err := strconv.Atoi(segs[0])
+		if err != nil || i < 0 || i >= len(d) {
+			return nil, false
+		}
+		child, ok := pathSet(d[i], segs[1:], val)
+		d[i] = child
+		return d, ok
+	}
+	return nil, false
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+	. "types"
+)
+
+func TestTypedValues(t *testing.T) {
+	mu.Lock()
+	defer mu.Unlock()
+	var doc interface{}
+	json.Unmarshal([]byte(`{"a":{"b":[1,2]},"c":"x"}`), &doc)
+	cases := []struct {
+		val  interface{}
+		tag  string
+		want string // the JSON of the value read back
+		typ  string
+	}{
+		{"s", "", `"s"`, ""},
+		{json.Number("12345678901234567"), "", `12345678901234567`, VAL_INT},
+		{json.Number("1.5"), "", `1.5`, VAL_FLOAT},
+		{2.0, VAL_FLOAT, `2`, VAL_FLOAT},
+		{true, "", `true`, VAL_BOOL},
+		{doc, "", `{"a":{"b":[1,2]},"c":"x"}`, VAL_JSON},
+		{"AAE=", VAL_BYTES, `"AAE="`, VAL_BYTES},
+	}
+	for i, c := range cases {
+		key := "tv" + string(rune('a'+i))
+		if resp := runOp("tv", Request{Op: CREATE, Key: key, Val: c.val, Type: c.tag, Readers: []string{"tv"}, Writers: []string{"tv"}}); resp.Status != OK {
+			t.Fatalf("create %v: %+v", c.val, resp)
+		}
+		resp := runOp("tv", Request{Op: READ, Key: key})
+		got, _ := json.Marshal(resp.Val)
+		if string(got) != c.want || resp.Type != c.typ {
+			t.Errorf("read %v: got %s %q", c.val, got, resp.Type)
+		}
+	}
+	if resp := runOp("tv", Request{Op: CREATE, Key: "tvbad", Val: "x", Type: VAL_INT}); resp.Error != ERR_BAD_REQUEST {
+		t.Errorf("expect a bad value: %+v", resp)
+	}
+
+	// the paths into the json value
+	if resp := runOp("tv", Request{Op: READ, Key: "tvf", Path: "a.b.1"}); resp.Status != OK || resp.Val != json.Number("2") || resp.Type != VAL_INT {
+		t.Errorf("read path: %+v", resp)
+	}
+	if resp := runOp("tv", Request{Op: WRITE, Key: "tvf", Path: "a.d", Val: "new"}); resp.Status != OK {
+		t.Errorf("write path: %+v", resp)
+	}
+	if resp := runOp("tv", Request{Op: WRITE, Key: "tvf", Path: "a.b.5", Val: 1}); resp.Error != ERR_BAD_REQUEST {
+		t.Errorf("expect a bad index: %+v", resp)
+	}
+	if resp := runOp("tv", Request{Op: READ, Key: "tvf", Path: "a.d"}); resp.Val != "new" || resp.Type != "" {
+		t.Errorf("read after write: %+v", resp)
+	}
+	if resp := runOp("tv", Request{Op: READ, Key: "tva", Path: "a"}); resp.Status != FAIL {
+		t.Errorf("expect no path in a string: %+v", resp)
+	}
+
+	// the expected value is compared in the form READ returns
+	cas := []struct {
+		key, expected string
+		ok            bool
+	}{
+		{"tvg", "AAE=", true},
+		{"tvg", "\x00\x01", false},
+		{"tvf", `{"c": "x", "a": {"d": "new", "b": [1, 2]}}`, true},
+		{"tvf", `{"c":"x"}`, false},
+		{"tvb", "12345678901234567", true},
+		{"tvb", "12345678901234568", false},
+	}
+	for _, c := range cas {
+		expected := c.expected
+		read := runOp("tv", Request{Op: READ, Key: c.key})
+		resp := runOp("tv", Request{Op: WRITE, Key: c.key, Val: read.Val, Type: read.Type, Expected_value: &expected})
+		if ok := resp.Status == OK; ok != c.ok || !ok && resp.Error != ERR_CONFLICT {
+			t.Errorf("write %s expecting %s: %+v", c.key, c.expected, resp)
+		}
+	}
+}
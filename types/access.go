@@ -0,0 +1,9 @@
+package types
+
+// a right of a user on a key and how it is derived
+type Access struct {
+	Key   string   `json:"key"`
+	Right string   `json:"right"` // readers, writers, copyfroms or copytos
+	Path  []string `json:"path"`  // the key, then the indirects down to the granting key
+	Via   string   `json:"via"`   // the granting entry, the uid or group:<name>
+}
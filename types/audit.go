@@ -0,0 +1,17 @@
+package types
+
+// An entry of the audit log. Hash covers the entry with Hash unset,
+// and Prev is the Hash of the previous entry, so an edit or a removed
+// entry breaks the chain.
+type AuditEntry struct {
+	Seq    int64     `json:"seq"`
+	Time   int64     `json:"time"` // unix nanoseconds
+	Uid    string    `json:"uid"`
+	Client string    `json:"client"`
+	Op     Operation `json:"op"`
+	Key    string    `json:"key,omitempty"`
+	Key2   string    `json:"key2,omitempty"` // the destination of a COPY
+	Status Code      `json:"status"`
+	Prev   []byte    `json:"prev"`
+	Hash   []byte    `json:"hash"`
+}
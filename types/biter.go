@@ -10,7 +10,11 @@ type BIter struct {
 
 // precondition of the Deref()
 func (iter *BIter) Valid() bool {
-	return iter.tree.Root != 0 && len(iter.path) > 0
+	if iter.tree.Root == 0 || len(iter.path) == 0 {
+		return false
+	}
+	level := len(iter.path) - 1
+	return iter.pos[level] < iter.path[level].Nkeys()
 }
 func (iter *BIter) Init() {
 	checkAssertion(iter.tree.Root != 0)
@@ -38,7 +42,8 @@ func iterNext(iter *BIter, level int) {
 	} else if level > 0 {
 		iterNext(iter, level-1) // move to a slibing node
 	} else {
-		return // dummy key
+		iter.pos[len(iter.pos)-1]++ // past the last key
+		return
 	}
 	if level+1 < len(iter.pos) {
 		// update the kid node
@@ -5,4 +5,6 @@ type Blindentry struct {
 	Tod        []byte `json:"tod"`
 	PublicKey  []byte `json:"publicKey"`
 	SessionKey []byte `json:"sessionKey"`
+	State      State  `json:"state"` // the state of the client
+	Mfa        bool   `json:"mfa"`   // verified with a one-time code
 }
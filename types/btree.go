@@ -277,6 +277,29 @@ func nodeDelete(tree *BTree, node BNode, idx uint16, key []byte) BNode {
 	return new
 }
 
+// insert or update a key with respect to the mode
 func (tree *BTree) InsertEx(req *InsertReq) {
-	return
+	old, exist := tree.Read(req.Key)
+	switch {
+	case exist && req.Mode == MODE_INSERT_ONLY:
+		return
+	case !exist && req.Mode == MODE_UPDATE_ONLY:
+		return
+	}
+	if exist {
+		req.Old = append([]byte{}, old...) // the page can be freed
+	}
+	tree.Insert(req.Key, req.Val)
+	req.Added = !exist
+	req.Updated = true
+}
+
+// delete a key and return the old value
+func (tree *BTree) DeleteEx(req *DeleteReq) bool {
+	old, exist := tree.Read(req.Key)
+	if !exist {
+		return false
+	}
+	req.Old = append([]byte{}, old...)
+	return tree.Delete(req.Key)
 }
@@ -0,0 +1,10 @@
+package types
+
+// a condition on an ACL entry, the entry grants nothing
+// unless all the set fields hold
+type Condition struct {
+	Until int64  `json:"until,omitempty"` // unix seconds
+	From  string `json:"from,omitempty"`  // "15:04" UTC, a daily window together with To
+	To    string `json:"to,omitempty"`
+	Mfa   bool   `json:"mfa,omitempty"` // the session is verified with a one-time code
+}
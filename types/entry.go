@@ -0,0 +1,9 @@
+package types
+
+// a key returned by LIST
+type Entry struct {
+	Key     string      `json:"key"`
+	Val     interface{} `json:"val,omitempty"`
+	Type    string      `json:"type,omitempty"`
+	Version uint64      `json:"version,omitempty"`
+}
@@ -0,0 +1,25 @@
+package types
+
+// why an operation failed, next to the FAIL status
+type ErrCode int
+
+const (
+	ERR_NONE ErrCode = iota
+	ERR_FAILED
+	ERR_BAD_REQUEST // missing or invalid parameters
+	ERR_NO_SESSION
+	ERR_NOT_FOUND
+	ERR_EXISTS
+	ERR_DENIED
+	ERR_CONFLICT
+)
+
+// how a right on a key was evaluated, for the owner of the key
+type Explain struct {
+	Key      string   `json:"key"`
+	Right    string   `json:"right"`    // readers, writers, copyfroms or copytos
+	Visited  []string `json:"visited"`  // the key and the keys reached through indirects
+	Granted  []string `json:"granted"`  // the users holding the right
+	Denied   []string `json:"denied"`   // the users in the deny list of the key
+	Inactive []string `json:"inactive"` // <key>:<entry> whose condition does not hold
+}
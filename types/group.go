@@ -0,0 +1,7 @@
+package types
+
+// a named set of principals, a member can be another group
+type Group struct {
+	Owner   string   `json:"owner"`
+	Members []string `json:"members"`
+}
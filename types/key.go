@@ -1,11 +1,20 @@
 package types
 
 type Key struct {
-	Writers   []string `json:"writers"`
-	Readers   []string `json:"readers"`
-	Copyfroms []string `json:"copyfroms"`
-	Copytos   []string `json:"copytos"`
-	Indirects []string `json:"indirects"`
-	Values    []string `json:"values`
-	Owner     string   `json:"owner"`
+	Writers    []string                        `json:"writers"`
+	Readers    []string                        `json:"readers"`
+	Copyfroms  []string                        `json:"copyfroms"`
+	Copytos    []string                        `json:"copytos"`
+	Indirects  []string                        `json:"indirects"`
+	Values     []string                        `json:"values"`
+	Owner      string                          `json:"owner"`
+	Coowners   []string                        `json:"coowners"`             // may MODACL and DELETE too
+	Pending    string                          `json:"pending,omitempty"`    // the new owner of a CHOWN to be accepted
+	Version    uint64                          `json:"version"`              // bumped by every acl change
+	Conditions map[string]map[string]Condition `json:"conditions,omitempty"` // list -> entry -> condition
+	// removed from the rights of this key, including the inherited ones
+	Deny_readers   []string `json:"deny_readers,omitempty"`
+	Deny_writers   []string `json:"deny_writers,omitempty"`
+	Deny_copyfroms []string `json:"deny_copyfroms,omitempty"`
+	Deny_copytos   []string `json:"deny_copytos,omitempty"`
 }
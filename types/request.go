@@ -15,6 +15,26 @@ const (
 	CHANGE_PASS
 	MODACL
 	REVACL
+	GROUP_CREATE
+	GROUP_ADD
+	GROUP_REMOVE
+	GROUP_LIST
+	CHOWN
+	CHOWN_ACCEPT
+	ACCESS
+	MFA_ENROLL
+	MFA_VERIFY
+	USER_LIST
+	USER_LOCK
+	USER_UNLOCK
+	RESET_PASS
+	SET_ROLE
+	AUDIT_QUERY
+	BATCH
+	LIST
+	INCR
+	APPEND
+	RENAME
 )
 
 type Request struct {
@@ -32,4 +52,51 @@ type Request struct {
 	Copytos   []string    `json:"copytos"`
 	Copyfroms []string    `json:"copyfroms"`
 	Indirects []string    `json:"indirects"`
+	Ttl       int64       `json:"ttl,omitempty"` // seconds until the key expires, for CREATE and WRITE
+	Group     string      `json:"group,omitempty"`
+	Members   []string    `json:"members,omitempty"` // uids or group:<name>
+	Coowners  []string    `json:"coowners,omitempty"`
+	New_owner string      `json:"new_owner,omitempty"`
+	New_key   string      `json:"new_key,omitempty"` // of RENAME
+	Rewrite   bool        `json:"rewrite,omitempty"` // RENAME in the indirects of the other keys of the owner
+	Accept    bool        `json:"accept,omitempty"`  // CHOWN waits for CHOWN_ACCEPT by the new owner
+	Subject   string      `json:"subject,omitempty"` // the user ACCESS and the admin operations act on
+	Role      string      `json:"role,omitempty"`
+	Explain   bool        `json:"explain,omitempty"` // explain a denied access to the owner
+	Batch     []Request   `json:"batch,omitempty"`   // the requests of a BATCH, done all or nothing
+	Otp       string      `json:"otp,omitempty"`     // the one-time code of MFA_VERIFY
+	Mfa       bool        `json:"-"`                 // set by the server from the session
+	Type      string      `json:"type,omitempty"`    // of val, inferred from the JSON type if empty
+	Path      string      `json:"path,omitempty"`    // READ or WRITE inside a json value, like a.b.0
+	Delta     int64       `json:"delta,omitempty"`   // added by INCR, 1 if zero
+	// LIST takes a prefix or a range from start to before end
+	Prefix string `json:"prefix,omitempty"`
+	Start  string `json:"start,omitempty"`
+	End    string `json:"end,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+	Cursor string `json:"cursor,omitempty"` // from the previous page
+	Values bool   `json:"values,omitempty"` // LIST the values with the keys
+	// MODACL replaces the conditions of the lists present, list -> entry -> condition
+	Conditions map[string]map[string]Condition `json:"conditions,omitempty"`
+	// take precedence over the grants of the key and of its indirects
+	Deny_readers   []string `json:"deny_readers,omitempty"`
+	Deny_writers   []string `json:"deny_writers,omitempty"`
+	Deny_copyfroms []string `json:"deny_copyfroms,omitempty"`
+	Deny_copytos   []string `json:"deny_copytos,omitempty"`
+	// MODACL edits of single principals, applied after the lists above
+	Add_readers      []string `json:"add_readers,omitempty"`
+	Remove_readers   []string `json:"remove_readers,omitempty"`
+	Add_writers      []string `json:"add_writers,omitempty"`
+	Remove_writers   []string `json:"remove_writers,omitempty"`
+	Add_copyfroms    []string `json:"add_copyfroms,omitempty"`
+	Remove_copyfroms []string `json:"remove_copyfroms,omitempty"`
+	Add_copytos      []string `json:"add_copytos,omitempty"`
+	Remove_copytos   []string `json:"remove_copytos,omitempty"`
+	Add_indirects    []string `json:"add_indirects,omitempty"`
+	Remove_indirects []string `json:"remove_indirects,omitempty"`
+	Add_coowners     []string `json:"add_coowners,omitempty"`
+	Remove_coowners  []string `json:"remove_coowners,omitempty"`
+	// the acl version for MODACL, the value version for WRITE, DELETE and the destination of COPY
+	Expected_version *uint64 `json:"expected_version,omitempty"`
+	Expected_value   *string `json:"expected_value,omitempty"` // the stored value for WRITE, DELETE and COPY
 }
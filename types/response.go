@@ -8,16 +8,39 @@ const (
 )
 
 type Response struct {
-	Status    Code        `json:"status"`
-	Val       interface{} `json:"val"`
-	Uid       string      `json:"uid"`
-	Writers   []string    `json:"writers"`
-	Readers   []string    `json:"readers"`
-	Copytos   []string    `json:"copytos"`
-	Copyfroms []string    `json:"copyfroms"`
-	Indirects []string    `json:"indirects"`
-	R         []string    `json:"r(k)"`
-	W         []string    `json:"w(k)"`
-	C_src     []string    `json:"c_src(k)"`
-	C_dst     []string    `json:"c_dst(k)"`
+	Status      Code                `json:"status"`
+	Error       ErrCode             `json:"error,omitempty"`
+	Message     string              `json:"message,omitempty"`
+	Val         interface{}         `json:"val"`
+	Type        string              `json:"type,omitempty"` // of val if not a string
+	Uid         string              `json:"uid"`
+	Writers     []string            `json:"writers"`
+	Readers     []string            `json:"readers"`
+	Copytos     []string            `json:"copytos"`
+	Copyfroms   []string            `json:"copyfroms"`
+	Indirects   []string            `json:"indirects"`
+	R           []string            `json:"r(k)"`
+	W           []string            `json:"w(k)"`
+	C_src       []string            `json:"c_src(k)"`
+	C_dst       []string            `json:"c_dst(k)"`
+	Groups      map[string][]string `json:"groups,omitempty"` // group name -> members
+	Owner       string              `json:"owner,omitempty"`
+	Coowners    []string            `json:"coowners,omitempty"`
+	Version     uint64              `json:"version,omitempty"`     // of the value
+	Acl_version uint64              `json:"acl_version,omitempty"` // of the acl, for REVACL
+	Access      []Access            `json:"access,omitempty"`
+	Users       []UserInfo          `json:"users,omitempty"`
+	Audit       []AuditEntry        `json:"audit,omitempty"`
+	Explain     []Explain           `json:"explain,omitempty"` // why a READ, WRITE or COPY was denied
+	Results     []Response          `json:"results,omitempty"` // of each request of a BATCH, up to the failed one
+	Entries     []Entry             `json:"entries,omitempty"`
+	Cursor      string              `json:"cursor,omitempty"` // of the next page of a LIST
+
+	Conditions map[string]map[string]Condition `json:"conditions,omitempty"`
+	Inactive   map[string][]string             `json:"inactive,omitempty"` // the entries whose condition does not hold now
+
+	Deny_readers   []string `json:"deny_readers,omitempty"`
+	Deny_writers   []string `json:"deny_writers,omitempty"`
+	Deny_copyfroms []string `json:"deny_copyfroms,omitempty"`
+	Deny_copytos   []string `json:"deny_copytos,omitempty"`
 }
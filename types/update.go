@@ -9,7 +9,9 @@ const (
 type InsertReq struct {
 	tree *BTree
 	// out
-	Added bool // added a new key
+	Added   bool   // added a new key
+	Updated bool   // added a new key or an old key was changed
+	Old     []byte // the value before the update
 	// in
 	Key  []byte
 	Val  []byte
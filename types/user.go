@@ -0,0 +1,8 @@
+package types
+
+// a user as listed to an admin
+type UserInfo struct {
+	Uid    string `json:"uid"`
+	Role   string `json:"role"`
+	Locked bool   `json:"locked"`
+}